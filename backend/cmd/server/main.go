@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -13,13 +18,21 @@ import (
 	"github.com/levyxx/LLM-debate-battle/backend/internal/auth"
 	"github.com/levyxx/LLM-debate-battle/backend/internal/db"
 	"github.com/levyxx/LLM-debate-battle/backend/internal/debatesvc"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
 	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/prompts"
 )
 
 func main() {
 	// 環境変数から設定を読み込み
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
+	providerName := os.Getenv("LLM_PROVIDER")
+	if providerName == "" {
+		providerName = "openai"
+	}
+
+	if providerName == "openai" && os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("OPENAI_BASE_URL") == "" {
 		log.Fatal("OPENAI_API_KEY environment variable is required")
 	}
 
@@ -33,6 +46,16 @@ func main() {
 		dbPath = "./debate.db"
 	}
 
+	// モデル料金表（既定値をMODEL_PRICESで上書き）
+	prices := llm.DefaultPriceTable()
+	if spec := os.Getenv("MODEL_PRICES"); spec != "" {
+		overrides, err := llm.ParsePriceTable(spec)
+		if err != nil {
+			log.Fatalf("Invalid MODEL_PRICES: %v", err)
+		}
+		prices = prices.Merge(overrides)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -45,15 +68,97 @@ func main() {
 	}
 	defer database.Close()
 
-	// OpenAIクライアント初期化
-	openaiClient := openai.NewClient(apiKey, model)
+	// LLMプロバイダ初期化
+	providers, cassette, err := newProviderRegistry(providerName, model)
+	if err != nil {
+		log.Fatalf("Failed to initialize LLM provider: %v", err)
+	}
+	if cassette != nil {
+		defer cassette.Close()
+	}
+
+	// プロンプトテンプレート（PROMPTS_DIRのファイルで組み込みのテンプレートを上書き）
+	promptStore, err := prompts.NewStore(os.Getenv("PROMPTS_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	log.Printf("Loaded prompt templates: %s", strings.Join(promptStore.Versions(), ", "))
+	go promptStore.Watch(context.Background(), envDuration("PROMPTS_RELOAD_INTERVAL", 5*time.Second))
+
+	switch aggregation := os.Getenv("JUDGE_AGGREGATION"); aggregation {
+	case "", "majority", "average":
+	default:
+		log.Fatalf("Invalid JUDGE_AGGREGATION=%q (majority or average)", aggregation)
+	}
+	switch outcome := os.Getenv("TIMEOUT_OUTCOME"); outcome {
+	case "", debatesvc.TimeoutJudge, debatesvc.TimeoutForfeit:
+	default:
+		log.Fatalf("Invalid TIMEOUT_OUTCOME=%q (judge or forfeit)", outcome)
+	}
+
+	// ディベートごとに指定できるモデル（既定のモデルに加え、許可リストとサーバーで設定したモデル）
+	judgePanel := envJudgePanel("JUDGE_PANEL")
+	difficultyModels := envDifficultyModels("DIFFICULTY_MODELS")
+	allowedModels := envList("LLM_ALLOWED_MODELS")
+	for _, spec := range judgePanel {
+		allowedModels = append(allowedModels, spec.Model)
+	}
+	for _, choice := range difficultyModels {
+		allowedModels = append(allowedModels, choice.Model)
+	}
+	providers.SetAllowedModels(allowedModels)
+	// 審査員パネルと難易度ごとのモデルはサーバーの設定のため、セッション作成時ではなく起動時に検証する
+	for i, spec := range judgePanel {
+		if _, _, err := providers.Resolve(spec.Provider, spec.Model); err != nil {
+			log.Fatalf("Invalid JUDGE_PANEL entry %d (%s:%s): %v", i+1, spec.Provider, spec.Model, err)
+		}
+	}
+	for difficulty, choice := range difficultyModels {
+		if _, _, err := providers.Resolve(choice.Provider, choice.Model); err != nil {
+			log.Fatalf("Invalid DIFFICULTY_MODELS entry for %s: %v", difficulty, err)
+		}
+	}
 
 	// サービス初期化
-	debateService := debatesvc.NewService(database, openaiClient)
+	debateService := debatesvc.NewService(database, providers, debatesvc.Config{
+		Prices:    prices,
+		MinRounds: envInt("DEBATE_MIN_ROUNDS", 2),
+		MaxRounds: envInt("DEBATE_MAX_ROUNDS", 5),
+
+		ContextTokens:      envInt("LLM_CONTEXT_TOKENS", 6000),
+		JudgeContextTokens: envInt("JUDGE_CONTEXT_TOKENS", 24000),
+		KeepRecentTurns:    envInt("CONTEXT_KEEP_TURNS", 4),
+
+		DebaterSampling: envSampling("DEBATER_SAMPLING"),
+		JudgeSampling:   envSampling("JUDGE_SAMPLING"),
+		TopicSampling:   envSampling("TOPIC_SAMPLING"),
+
+		Prompts: promptStore,
+		Formats: envFormats("DEBATE_FORMATS_FILE"),
+
+		JudgePanel:       judgePanel,
+		JudgeAggregation: os.Getenv("JUDGE_AGGREGATION"),
+		BiasCheck:        envBool("JUDGE_BIAS_CHECK", false),
+
+		DifficultyModels: difficultyModels,
+
+		FactCheck:      envBool("FACT_CHECK", false),
+		FactCheckJudge: envBool("FACT_CHECK_JUDGE", false),
+
+		HintBudget: envInt("HINT_BUDGET", 3),
+		Feedback:   envBool("FEEDBACK_REPORT", true),
+
+		TurnLimit:      envDuration("DEBATE_TURN_LIMIT", 0),
+		TotalLimit:     envDuration("DEBATE_TOTAL_LIMIT", 0),
+		TimeoutOutcome: os.Getenv("TIMEOUT_OUTCOME"),
+	})
+	// 放置されたセッションを定期的に終了
+	go debateService.RunSweeper(context.Background(), envDuration("SWEEP_INTERVAL", time.Minute))
+
 	tokenStore := auth.NewTokenStore()
 
 	// ハンドラー初期化
-	handlers := api.NewHandlers(database, debateService, tokenStore)
+	handlers := api.NewHandlers(database, debateService, tokenStore, envList("ADMIN_USERS"))
 
 	// ルーター設定
 	r := chi.NewRouter()
@@ -85,7 +190,238 @@ func main() {
 	log.Printf("📡 Backend API: http://localhost:%s", port)
 	log.Printf("🌐 Frontend:    http://localhost:3000")
 	log.Printf("")
+	log.Printf("🤖 LLM Provider: %s", providerName)
 	log.Printf("🤖 OpenAI Model: %s", model)
 	log.Println("========================================")
 	log.Fatal(http.ListenAndServe(":"+port, r))
 }
+
+// 利用可能なプロバイダを登録したレジストリを作成
+// "openai": OpenAI API（OPENAI_API_KEYまたはOPENAI_BASE_URLが必要）
+// "local":  OpenAI互換のセルフホストサーバー（LOCAL_LLM_BASE_URLを指定した場合のみ）
+// "fake":   オフライン用の偽プロバイダ（LLM_PROVIDER=fakeの場合のみ）
+// LLM_RECORD_CASSETTEを指定すると、OpenAI互換プロバイダとのやり取りをカセットに記録する（開いたカセットも返す）
+func newProviderRegistry(defaultProvider, model string) (*llm.Registry, *fakellm.Cassette, error) {
+	registry := llm.NewRegistry(defaultProvider, model)
+
+	policy := llm.DefaultRetryPolicy()
+	policy.MaxRetries = envInt("LLM_MAX_RETRIES", policy.MaxRetries)
+	policy.BreakerThreshold = envInt("LLM_BREAKER_THRESHOLD", policy.BreakerThreshold)
+	policy.BreakerCooldown = envDuration("LLM_BREAKER_COOLDOWN", policy.BreakerCooldown)
+
+	var cassette *fakellm.Cassette
+	if path := os.Getenv("LLM_RECORD_CASSETTE"); path != "" {
+		var err error
+		cassette, err = fakellm.OpenCassette(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("Recording LLM interactions to %s", path)
+	}
+
+	// OpenAI互換プロバイダ（モデルごとにクライアントとサーキットブレーカーを作成）
+	registerCompatible := func(name string, cfg openai.Config) {
+		registry.Register(name, func(model string) (llm.Provider, error) {
+			modelCfg := cfg
+			modelCfg.Model = model
+			var provider llm.Provider = llm.NewResilient(openai.NewClient(modelCfg), name+"/"+model, policy)
+			if cassette != nil {
+				provider = cassette.Wrap(provider)
+			}
+			return provider, nil
+		})
+	}
+
+	if cfg := openaiConfigFromEnv("OPENAI"); cfg.APIKey != "" || cfg.BaseURL != "" {
+		registerCompatible("openai", cfg)
+	}
+	// セルフホストのOpenAI互換サーバー（llama.cpp server, vLLM, Ollama等）
+	if cfg := openaiConfigFromEnv("LOCAL_LLM"); cfg.BaseURL != "" {
+		registerCompatible("local", cfg)
+	}
+
+	if defaultProvider == "fake" {
+		fake, err := newFakeProvider()
+		if err != nil {
+			return nil, nil, err
+		}
+		registry.Register("fake", func(model string) (llm.Provider, error) {
+			return fake, nil
+		})
+	}
+
+	// 既定のプロバイダが利用できることを確認
+	if _, err := registry.Default(); err != nil {
+		return nil, nil, err
+	}
+	return registry, cassette, nil
+}
+
+// <prefix>_API_KEY, _BASE_URL, _HEADERS, _STRUCTURED_OUTPUT からOpenAI互換クライアントの設定を作成
+// APIキーなしでベースURLのみ指定した場合はAuthorizationヘッダーを送らない
+func openaiConfigFromEnv(prefix string) openai.Config {
+	cfg := openai.Config{
+		APIKey:           strings.TrimSpace(os.Getenv(prefix + "_API_KEY")),
+		BaseURL:          strings.TrimSpace(os.Getenv(prefix + "_BASE_URL")),
+		StructuredOutput: strings.TrimSpace(os.Getenv(prefix + "_STRUCTURED_OUTPUT")),
+	}
+	cfg.NoAuth = cfg.APIKey == "" && cfg.BaseURL != ""
+
+	// "Key=Value,Key2=Value2" 形式
+	for _, pair := range strings.Split(os.Getenv(prefix+"_HEADERS"), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = map[string]string{}
+		}
+		cfg.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return cfg
+}
+
+// FAKE_LLM_MODE（scripted|replay）に応じた偽プロバイダを作成
+func newFakeProvider() (llm.Provider, error) {
+	switch mode := os.Getenv("FAKE_LLM_MODE"); mode {
+	case "", "scripted":
+		return fakellm.NewScripted(nil), nil
+	case "replay":
+		path := os.Getenv("FAKE_LLM_CASSETTE")
+		if path == "" {
+			return nil, fmt.Errorf("FAKE_LLM_CASSETTE is required in replay mode")
+		}
+		return fakellm.NewReplayer(path)
+	default:
+		return nil, fmt.Errorf("unknown FAKE_LLM_MODE %q", mode)
+	}
+}
+
+// 整数の環境変数を読み込み（未設定・不正な値の場合はデフォルト値）
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// 真偽値の環境変数を読み込み（未設定・不正な値の場合はデフォルト値）
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %t", key, value, def)
+		return def
+	}
+	return b
+}
+
+// カンマ区切りの環境変数を読み込み（空の要素は除く）
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// 時間の環境変数を読み込み（例: "30s"、未設定・不正な値の場合はデフォルト値）
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+// 環境変数からサンプリングパラメータを読み込む（"temperature=0.2,seed=42" 形式）
+func envSampling(key string) llm.Sampling {
+	spec := os.Getenv(key)
+	if spec == "" {
+		return llm.Sampling{}
+	}
+	sampling, err := llm.ParseSampling(spec)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return sampling
+}
+
+// 環境変数で指定したJSONファイルからディベート形式を読み込む（未設定の場合は組み込みの形式のみ）
+func envFormats(key string) map[string]models.DebateFormat {
+	path := os.Getenv(key)
+	if path == "" {
+		return nil
+	}
+	list, err := debatesvc.LoadFormats(path)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	formats := make(map[string]models.DebateFormat, len(list))
+	for _, f := range list {
+		formats[f.Name] = f
+	}
+	return formats
+}
+
+// 環境変数から審査員パネルを読み込む
+// カンマ区切りで "[観点@]プロバイダ[:モデル]" を並べる（例: "logic@openai:gpt-4o,evidence@local,openai"）
+func envJudgePanel(key string) []models.JudgeSpec {
+	var panel []models.JudgeSpec
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var spec models.JudgeSpec
+		if persona, rest, ok := strings.Cut(entry, "@"); ok {
+			spec.Persona = persona
+			entry = rest
+		}
+		spec.Provider, spec.Model, _ = strings.Cut(entry, ":")
+		if spec.Provider == "" {
+			log.Fatalf("Invalid %s entry %q: provider is empty", key, entry)
+		}
+		panel = append(panel, spec)
+	}
+	return panel
+}
+
+// "difficulty=provider[:model]" のカンマ区切りを難易度ごとのモデルとして読み込む
+func envDifficultyModels(key string) map[string]debatesvc.ModelChoice {
+	choices := map[string]debatesvc.ModelChoice{}
+	for _, entry := range envList(key) {
+		difficulty, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Fatalf("Invalid %s entry %q: expected difficulty=provider[:model]", key, entry)
+		}
+		switch difficulty {
+		case "easy", "normal", "hard", "expert":
+		default:
+			log.Fatalf("Invalid %s entry %q: unknown difficulty %q", key, entry, difficulty)
+		}
+		var choice debatesvc.ModelChoice
+		choice.Provider, choice.Model, _ = strings.Cut(rest, ":")
+		if choice.Provider == "" {
+			log.Fatalf("Invalid %s entry %q: provider is empty", key, entry)
+		}
+		choices[difficulty] = choice
+	}
+	return choices
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/debatesvc"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+)
+
+// サービスのエラー（LLM呼び出しエラーの分類など）に応じたHTTPステータスとメッセージを返す
+// 分類できないエラーはfallbackのメッセージで500を返す
+func errorStatus(err error, fallback string) (int, string) {
+	if errors.Is(err, debatesvc.ErrInvalidRequest) {
+		return http.StatusBadRequest, err.Error()
+	}
+	if errors.Is(err, debatesvc.ErrNotParticipant) {
+		return http.StatusForbidden, err.Error()
+	}
+	if errors.Is(err, debatesvc.ErrOutOfTurn) || errors.Is(err, debatesvc.ErrHintLimit) || errors.Is(err, debatesvc.ErrTimeLimit) {
+		return http.StatusConflict, err.Error()
+	}
+
+	switch llm.KindOf(err) {
+	case llm.ErrorRateLimit:
+		return http.StatusTooManyRequests, "LLM rate limit exceeded, please retry later"
+	case llm.ErrorTimeout:
+		return http.StatusGatewayTimeout, "LLM request timed out"
+	case llm.ErrorContentFilter:
+		return http.StatusUnprocessableEntity, "Content was rejected by the LLM content filter"
+	case llm.ErrorAuth:
+		return http.StatusBadGateway, "LLM provider authentication failed"
+	case llm.ErrorUnavailable:
+		return http.StatusServiceUnavailable, "LLM provider is temporarily unavailable"
+	default:
+		return http.StatusInternalServerError, fallback
+	}
+}
+
+// サービスのエラーをHTTPレスポンスとして返す
+func respondError(w http.ResponseWriter, err error, fallback string) {
+	var llmErr *llm.Error
+	if errors.As(err, &llmErr) && llmErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(llmErr.RetryAfter.Seconds()))))
+	}
+
+	status, message := errorStatus(err, fallback)
+	http.Error(w, message, status)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -18,13 +19,19 @@ type Handlers struct {
 	database      *db.DB
 	debateService *debatesvc.Service
 	tokenStore    *auth.TokenStore
+	admins        map[string]bool // 管理者のユーザー名
 }
 
-func NewHandlers(database *db.DB, debateService *debatesvc.Service, tokenStore *auth.TokenStore) *Handlers {
+func NewHandlers(database *db.DB, debateService *debatesvc.Service, tokenStore *auth.TokenStore, admins []string) *Handlers {
+	adminSet := make(map[string]bool, len(admins))
+	for _, name := range admins {
+		adminSet[name] = true
+	}
 	return &Handlers{
 		database:      database,
 		debateService: debateService,
 		tokenStore:    tokenStore,
+		admins:        adminSet,
 	}
 }
 
@@ -41,14 +48,30 @@ func (h *Handlers) Register(r chi.Router) {
 		r.Get("/api/auth/me", h.GetCurrentUser)
 
 		r.Post("/api/debate/create", h.CreateDebate)
+		r.Post("/api/debate/join", h.JoinDebate)
 		r.Post("/api/debate/message", h.SendMessage)
+		r.Post("/api/debate/message/stream", h.SendMessageStream)
 		r.Post("/api/debate/end", h.EndDebate)
+		r.Post("/api/debate/hint", h.GetHint)
 		r.Post("/api/debate/llm-step", h.LLMDebateStep)
+		r.Post("/api/debate/llm-step/stream", h.LLMDebateStepStream)
+		r.Get("/api/debate/formats", h.GetFormats)
+		r.Get("/api/debate/personas", h.GetPersonas)
 		r.Get("/api/debate/{id}", h.GetDebate)
 		r.Get("/api/debate/{id}/messages", h.GetDebateMessages)
+		r.Get("/api/debate/{id}/feedback", h.GetFeedbackReport)
 
 		r.Get("/api/user/stats", h.GetUserStats)
 		r.Get("/api/user/history", h.GetUserHistory)
+		r.Get("/api/user/usage", h.GetUserUsage)
+		r.Get("/api/user/feedback", h.GetFeedbackTrends)
+
+		// 管理者のみ
+		r.Group(func(r chi.Router) {
+			r.Use(h.AdminMiddleware)
+
+			r.Get("/api/admin/judge-bias", h.GetBiasStats)
+		})
 	})
 
 	// トピック生成は認証なしでも可能
@@ -82,6 +105,18 @@ func (h *Handlers) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// 管理者以外のアクセスを拒否（AuthMiddlewareの後に使う）
+func (h *Handlers) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.database.GetUserByID(getUserID(r.Context()))
+		if err != nil || !h.admins[user.Username] {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // ユーザー登録
 func (h *Handlers) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
@@ -174,10 +209,10 @@ func (h *Handlers) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 
 // トピック生成
 func (h *Handlers) GenerateTopic(w http.ResponseWriter, r *http.Request) {
-	topic, err := h.debateService.GenerateRandomTopic(r.Context())
+	topic, err := h.debateService.GenerateRandomTopic(r.Context(), r.URL.Query().Get("language"))
 	if err != nil {
 		log.Printf("Failed to generate topic: %v", err)
-		http.Error(w, "Failed to generate topic", http.StatusInternalServerError)
+		respondError(w, err, "Failed to generate topic")
 		return
 	}
 	respondJSON(w, http.StatusOK, topic)
@@ -192,24 +227,39 @@ func (h *Handlers) CreateDebate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := getUserID(r.Context())
-	var userIDPtr *int64
-	if req.Mode == "user_vs_llm" {
-		userIDPtr = &userID
-	}
 
-	session, topicInfo, err := h.debateService.CreateDebateSession(r.Context(), userIDPtr, &req)
+	session, topicInfo, err := h.debateService.CreateDebateSession(r.Context(), &userID, &req)
 	if err != nil {
 		log.Printf("Failed to create debate: %v", err)
-		http.Error(w, "Failed to create debate", http.StatusInternalServerError)
+		respondError(w, err, "Failed to create debate")
 		return
 	}
 
 	respondJSON(w, http.StatusCreated, models.CreateDebateResponse{
-		Session:   *session,
-		TopicInfo: topicInfo,
+		Session:    *session,
+		TopicInfo:  topicInfo,
+		InviteCode: session.InviteCode,
 	})
 }
 
+// 招待コードでユーザー同士のディベートに参加
+func (h *Handlers) JoinDebate(w http.ResponseWriter, r *http.Request) {
+	var req models.JoinDebateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.debateService.JoinDebate(r.Context(), getUserID(r.Context()), req.InviteCode, req.Side)
+	if err != nil {
+		log.Printf("Failed to join debate: %v", err)
+		respondError(w, err, "Failed to join debate")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.CreateDebateResponse{Session: *session})
+}
+
 // メッセージ送信
 func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 	var req models.SendMessageRequest
@@ -218,17 +268,74 @@ func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userMsg, llmMsg, err := h.debateService.ProcessUserMessage(r.Context(), req.SessionID, req.Content)
+	resp, err := h.debateService.ProcessUserMessage(r.Context(), req.SessionID, getUserID(r.Context()), req.Content)
 	if err != nil {
 		log.Printf("Failed to process message: %v", err)
+		respondError(w, err, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// メッセージ送信（LLMの応答をSSEでストリーミング）
+func (h *Handlers) SendMessageStream(w http.ResponseWriter, r *http.Request) {
+	var req models.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, models.SendMessageResponse{
-		UserMessage: userMsg,
-		LLMMessage:  *llmMsg,
+	resp, err := h.debateService.ProcessUserMessageStream(r.Context(), req.SessionID, getUserID(r.Context()), req.Content, func(role, delta string) error {
+		return sse.send("delta", models.StreamDelta{Role: role, Content: delta})
 	})
+	if err != nil {
+		log.Printf("Failed to process message: %v", err)
+		sse.sendError(err)
+		return
+	}
+
+	sse.send("done", resp)
+}
+
+// コーチのヒントを取得（user_vs_llm でユーザーの番のみ）
+func (h *Handlers) GetHint(w http.ResponseWriter, r *http.Request) {
+	var req models.HintRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.debateService.GetHint(r.Context(), req.SessionID, getUserID(r.Context()))
+	if err != nil {
+		log.Printf("Failed to get hint: %v", err)
+		respondError(w, err, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// 利用できるディベート形式の一覧
+func (h *Handlers) GetFormats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.debateService.ListFormats())
+}
+
+// AI討論者のペルソナの一覧と戦績（?language= で表示名の言語を指定）
+func (h *Handlers) GetPersonas(w http.ResponseWriter, r *http.Request) {
+	personas, err := h.debateService.ListPersonas(r.URL.Query().Get("language"))
+	if err != nil {
+		log.Printf("Failed to list personas: %v", err)
+		respondError(w, err, "Failed to list personas")
+		return
+	}
+	respondJSON(w, http.StatusOK, personas)
 }
 
 // LLM同士のディベートを1ステップ進める
@@ -241,18 +348,42 @@ func (h *Handlers) LLMDebateStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	llm1Msg, llm2Msg, isFinished, err := h.debateService.ProcessLLMDebateStep(r.Context(), req.SessionID)
+	step, err := h.debateService.ProcessLLMDebateStep(r.Context(), req.SessionID, getUserID(r.Context()))
 	if err != nil {
 		log.Printf("Failed to process LLM debate step: %v", err)
+		respondError(w, err, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, step)
+}
+
+// LLM同士のディベートを1ステップ進める（応答をSSEでストリーミング）
+func (h *Handlers) LLMDebateStepStream(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SessionID int64 `json:"session_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, models.LLMDebateStepResponse{
-		LLM1Message: llm1Msg,
-		LLM2Message: llm2Msg,
-		IsFinished:  isFinished,
+	step, err := h.debateService.ProcessLLMDebateStepStream(r.Context(), req.SessionID, getUserID(r.Context()), func(role, delta string) error {
+		return sse.send("delta", models.StreamDelta{Role: role, Content: delta})
 	})
+	if err != nil {
+		log.Printf("Failed to process LLM debate step: %v", err)
+		sse.sendError(err)
+		return
+	}
+
+	sse.send("done", step)
 }
 
 // ディベート終了
@@ -263,17 +394,14 @@ func (h *Handlers) EndDebate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, judgeResult, err := h.debateService.EndDebate(r.Context(), req.SessionID)
+	resp, err := h.debateService.EndDebate(r.Context(), req.SessionID, getUserID(r.Context()))
 	if err != nil {
 		log.Printf("Failed to end debate: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, err, err.Error())
 		return
 	}
 
-	respondJSON(w, http.StatusOK, models.EndDebateResponse{
-		Session:     *session,
-		JudgeResult: *judgeResult,
-	})
+	respondJSON(w, http.StatusOK, resp)
 }
 
 // ディベート詳細取得
@@ -291,9 +419,22 @@ func (h *Handlers) GetDebate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	usage, err := h.debateService.GetSessionUsage(id)
+	if err != nil {
+		log.Printf("Failed to get session usage: %v", err)
+	}
+
+	verdict, ballots, err := h.debateService.GetJudgeResults(id)
+	if err != nil {
+		log.Printf("Failed to get judge results: %v", err)
+	}
+
 	respondJSON(w, http.StatusOK, models.DebateHistoryResponse{
 		Session:  *session,
 		Messages: messages,
+		Usage:    usage,
+		Verdict:  verdict,
+		Ballots:  ballots,
 	})
 }
 
@@ -315,6 +456,40 @@ func (h *Handlers) GetDebateMessages(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, messages)
 }
 
+// ディベート終了後のユーザーの発言へのフィードバック取得
+func (h *Handlers) GetFeedbackReport(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid debate ID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.debateService.GetFeedbackReport(id, getUserID(r.Context()))
+	if errors.Is(err, debatesvc.ErrNotParticipant) {
+		respondError(w, err, "Feedback not found")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Feedback not found", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// ユーザーのフィードバックを通した弱点の傾向取得
+func (h *Handlers) GetFeedbackTrends(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+	trends, err := h.debateService.GetFeedbackTrends(userID)
+	if err != nil {
+		log.Printf("Failed to get feedback trends: %v", err)
+		http.Error(w, "Failed to get feedback trends", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, trends)
+}
+
 // ユーザー統計取得
 func (h *Handlers) GetUserStats(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r.Context())
@@ -339,6 +514,29 @@ func (h *Handlers) GetUserHistory(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, history)
 }
 
+// ユーザーのLLM使用量取得
+func (h *Handlers) GetUserUsage(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+	usage, err := h.debateService.GetUserUsage(userID)
+	if err != nil {
+		log.Printf("Failed to get user usage: %v", err)
+		http.Error(w, "Failed to get usage", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, usage)
+}
+
+// 審査員の位置バイアスの集計（管理者用）
+func (h *Handlers) GetBiasStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.debateService.GetBiasStats()
+	if err != nil {
+		log.Printf("Failed to get bias stats: %v", err)
+		http.Error(w, "Failed to get bias stats", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
+
 // ヘルパー関数
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
@@ -73,10 +75,210 @@ func (d *DB) migrate() error {
 		draws INTEGER DEFAULT 0,
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS llm_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER,
+		role TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS debate_summaries (
+		session_id INTEGER PRIMARY KEY,
+		through_message_id INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS judge_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		judge_provider TEXT,
+		judge_model TEXT,
+		persona TEXT,
+		prompt_version TEXT,
+		winner TEXT NOT NULL,
+		pro_score INTEGER DEFAULT 0,
+		con_score INTEGER DEFAULT 0,
+		reasoning TEXT,
+		pro_strengths TEXT,
+		pro_weaknesses TEXT,
+		con_strengths TEXT,
+		con_weaknesses TEXT,
+		final_comment TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_judge_results_session ON judge_results(session_id);
+
+	CREATE TABLE IF NOT EXISTS fact_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		claim TEXT NOT NULL,
+		rating TEXT NOT NULL,
+		note TEXT,
+		prompt_version TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id),
+		FOREIGN KEY (message_id) REFERENCES debate_messages(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_fact_checks_session ON fact_checks(session_id);
+
+	CREATE TABLE IF NOT EXISTS feedback_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER UNIQUE NOT NULL,
+		user_id INTEGER,
+		summary TEXT,
+		turns TEXT,
+		missed_rebuttals TEXT,
+		fallacies TEXT,
+		practice_topics TEXT,
+		weaknesses TEXT,
+		prompt_version TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_feedback_reports_user ON feedback_reports(user_id);
+
+	CREATE TABLE IF NOT EXISTS debate_participants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		side TEXT NOT NULL,
+		speaker_order INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		user_id INTEGER,
+		provider TEXT,
+		model TEXT,
+		rating_change REAL,
+		UNIQUE (session_id, role),
+		FOREIGN KEY (session_id) REFERENCES debate_sessions(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_debate_participants_user ON debate_participants(user_id);
 	`
 
-	_, err := d.conn.Exec(schema)
-	return err
+	if _, err := d.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	if err := d.addMissingColumns(); err != nil {
+		return err
+	}
+
+	// 招待コードは後から追加したカラムのため、カラムの追加後に一意にする（コードのないセッションは対象外）
+	if _, err := d.conn.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_debate_sessions_invite_code
+		ON debate_sessions(invite_code) WHERE invite_code IS NOT NULL AND invite_code != ''`); err != nil {
+		return err
+	}
+	return d.migrateJudgeMessages()
+}
+
+// 既存のテーブルに後から追加したカラム
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"debate_sessions", "llm1_provider", "TEXT"},
+	{"debate_sessions", "llm1_model", "TEXT"},
+	{"debate_sessions", "llm2_provider", "TEXT"},
+	{"debate_sessions", "llm2_model", "TEXT"},
+	{"debate_sessions", "judge_provider", "TEXT"},
+	{"debate_sessions", "judge_model", "TEXT"},
+	{"debate_sessions", "structured_turns", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "min_rounds", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "max_rounds", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "end_reason", "TEXT"},
+	{"debate_sessions", "debater_sampling", "TEXT"},
+	{"debate_sessions", "judge_sampling", "TEXT"},
+	{"debate_sessions", "topic_sampling", "TEXT"},
+	{"debate_sessions", "language", "TEXT DEFAULT 'ja'"},
+	{"debate_sessions", "format", "TEXT DEFAULT 'free'"},
+	{"debate_sessions", "current_phase", "TEXT"},
+	{"debate_sessions", "turn_index", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "judge_panel", "TEXT"},
+	{"debate_sessions", "judge_aggregation", "TEXT"},
+	{"debate_sessions", "bias_check", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "position_bias", "INTEGER"},
+	{"debate_sessions", "persona", "TEXT"},
+	{"debate_sessions", "difficulty", "TEXT"},
+	{"debate_sessions", "llm_provider", "TEXT"},
+	{"debate_sessions", "llm_model", "TEXT"},
+	{"debate_sessions", "rating_change", "REAL"},
+	{"debate_sessions", "fact_check", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "hint_budget", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "hints_used", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "turn_seconds", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "total_seconds", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "deadline", "DATETIME"},
+	{"debate_sessions", "turn_deadline", "DATETIME"},
+	{"debate_sessions", "passes", "INTEGER DEFAULT 0"},
+	{"debate_sessions", "user2_id", "INTEGER"},
+	{"debate_sessions", "user2_position", "TEXT"},
+	{"debate_sessions", "user2_rating_change", "REAL"},
+	{"debate_sessions", "invite_code", "TEXT"},
+	{"debate_sessions", "created_by", "INTEGER"},
+	{"user_stats", "assisted_wins", "INTEGER DEFAULT 0"},
+	{"user_stats", "rating", "REAL DEFAULT 1200"},
+	{"debate_messages", "key_points", "TEXT"},
+	{"debate_messages", "counterpoint", "TEXT"},
+	{"debate_messages", "prompt_version", "TEXT"},
+	{"debate_messages", "phase", "TEXT"},
+	{"debate_messages", "participant_id", "INTEGER"},
+	{"judge_results", "swapped", "INTEGER DEFAULT 0"},
+	{"judge_results", "hints_used", "INTEGER DEFAULT 0"},
+}
+
+// 既存のデータベースに不足しているカラムを追加
+func (d *DB) addMissingColumns() error {
+	for _, c := range addedColumns {
+		exists, err := d.columnExists(c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := d.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+func (d *DB) columnExists(table, column string) (bool, error) {
+	rows, err := d.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 // ユーザー作成
@@ -134,10 +336,27 @@ func (d *DB) GetUserByID(id int64) (*models.User, error) {
 }
 
 // ディベートセッション作成
-func (d *DB) CreateDebateSession(userID *int64, mode, topic, userPosition string) (*models.DebateSession, error) {
+func (d *DB) CreateDebateSession(session *models.DebateSession) (*models.DebateSession, error) {
 	result, err := d.conn.Exec(
-		"INSERT INTO debate_sessions (user_id, mode, topic, user_position) VALUES (?, ?, ?, ?)",
-		userID, mode, topic, userPosition,
+		`INSERT INTO debate_sessions (user_id, mode, topic, user_position, status,
+			llm1_provider, llm1_model, llm2_provider, llm2_model, judge_provider, judge_model, structured_turns,
+			min_rounds, max_rounds, debater_sampling, judge_sampling, topic_sampling, language,
+			format, current_phase, judge_panel, judge_aggregation, bias_check, persona,
+			difficulty, llm_provider, llm_model, fact_check, hint_budget,
+			turn_seconds, total_seconds, deadline, turn_deadline, user2_position, invite_code, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.Mode, session.Topic, session.UserPosition, session.Status,
+		session.LLM1Provider, session.LLM1Model, session.LLM2Provider, session.LLM2Model,
+		session.JudgeProvider, session.JudgeModel, session.StructuredTurns,
+		session.MinRounds, session.MaxRounds,
+		samplingJSON(session.DebaterSampling), samplingJSON(session.JudgeSampling), samplingJSON(session.TopicSampling),
+		session.Language, session.Format, nullString(session.CurrentPhase),
+		panelJSON(session.JudgePanel), nullString(session.JudgeAggregation), session.BiasCheck,
+		nullString(session.Persona),
+		nullString(session.Difficulty), nullString(session.LLMProvider), nullString(session.LLMModel),
+		session.FactCheck, session.HintBudget,
+		session.TurnSeconds, session.TotalSeconds, session.Deadline, session.TurnDeadline,
+		nullString(session.User2Position), nullString(session.InviteCode), session.CreatedBy,
 	)
 	if err != nil {
 		return nil, err
@@ -147,22 +366,52 @@ func (d *DB) CreateDebateSession(userID *int64, mode, topic, userPosition string
 	return d.GetDebateSession(id)
 }
 
-// ディベートセッション取得
-func (d *DB) GetDebateSession(id int64) (*models.DebateSession, error) {
+// debate_sessionsから取得するカラム（scanSessionと順序を合わせる）
+const sessionColumns = `id, user_id, mode, topic, user_position, status, winner, judge_comment, created_at, ended_at,
+	llm1_provider, llm1_model, llm2_provider, llm2_model, judge_provider, judge_model, structured_turns,
+	min_rounds, max_rounds, end_reason, debater_sampling, judge_sampling, topic_sampling, language,
+	format, current_phase, turn_index, judge_panel, judge_aggregation, bias_check, position_bias, persona,
+	difficulty, llm_provider, llm_model, rating_change, fact_check, hint_budget, hints_used,
+	turn_seconds, total_seconds, deadline, turn_deadline, passes,
+	user2_id, user2_position, user2_rating_change, invite_code, created_by`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// sessionColumnsの1行をDebateSessionに読み込む
+func scanSession(row rowScanner) (*models.DebateSession, error) {
 	var session models.DebateSession
 	var userID sql.NullInt64
 	var userPosition sql.NullString
 	var winner sql.NullString
 	var judgeComment sql.NullString
 	var finishedAt sql.NullTime
+	var llm1Provider, llm1Model, llm2Provider, llm2Model, judgeProvider, judgeModel sql.NullString
+	var endReason sql.NullString
+	var debaterSampling, judgeSampling, topicSampling sql.NullString
+	var language, format, currentPhase sql.NullString
+	var judgePanel, judgeAggregation sql.NullString
+	var positionBias sql.NullBool
+	var persona sql.NullString
+	var difficulty, llmProvider, llmModel sql.NullString
+	var ratingChange sql.NullFloat64
+	var deadline, turnDeadline sql.NullTime
+	var user2ID, createdBy sql.NullInt64
+	var user2Position, inviteCode sql.NullString
+	var user2RatingChange sql.NullFloat64
 
-	err := d.conn.QueryRow(
-		`SELECT id, user_id, mode, topic, user_position, status, winner, judge_comment, created_at, ended_at 
-		FROM debate_sessions WHERE id = ?`,
-		id,
-	).Scan(&session.ID, &userID, &session.Mode, &session.Topic, &userPosition,
-		&session.Status, &winner, &judgeComment, &session.CreatedAt, &finishedAt)
-	if err != nil {
+	if err := row.Scan(&session.ID, &userID, &session.Mode, &session.Topic, &userPosition,
+		&session.Status, &winner, &judgeComment, &session.CreatedAt, &finishedAt,
+		&llm1Provider, &llm1Model, &llm2Provider, &llm2Model, &judgeProvider, &judgeModel,
+		&session.StructuredTurns, &session.MinRounds, &session.MaxRounds, &endReason,
+		&debaterSampling, &judgeSampling, &topicSampling, &language,
+		&format, &currentPhase, &session.TurnIndex, &judgePanel, &judgeAggregation,
+		&session.BiasCheck, &positionBias, &persona,
+		&difficulty, &llmProvider, &llmModel, &ratingChange, &session.FactCheck,
+		&session.HintBudget, &session.HintsUsed,
+		&session.TurnSeconds, &session.TotalSeconds, &deadline, &turnDeadline, &session.Passes,
+		&user2ID, &user2Position, &user2RatingChange, &inviteCode, &createdBy); err != nil {
 		return nil, err
 	}
 
@@ -181,48 +430,367 @@ func (d *DB) GetDebateSession(id int64) (*models.DebateSession, error) {
 	if finishedAt.Valid {
 		session.FinishedAt = &finishedAt.Time
 	}
+	session.LLM1Provider = llm1Provider.String
+	session.LLM1Model = llm1Model.String
+	session.LLM2Provider = llm2Provider.String
+	session.LLM2Model = llm2Model.String
+	session.JudgeProvider = judgeProvider.String
+	session.JudgeModel = judgeModel.String
+	session.EndReason = endReason.String
+	session.DebaterSampling = parseSampling(debaterSampling)
+	session.JudgeSampling = parseSampling(judgeSampling)
+	session.TopicSampling = parseSampling(topicSampling)
+	session.Language = language.String
+	session.Format = format.String
+	session.CurrentPhase = currentPhase.String
+	session.JudgePanel = parsePanel(judgePanel)
+	session.JudgeAggregation = judgeAggregation.String
+	if positionBias.Valid {
+		session.PositionBias = &positionBias.Bool
+	}
+	session.Persona = persona.String
+	session.Difficulty = difficulty.String
+	session.LLMProvider = llmProvider.String
+	session.LLMModel = llmModel.String
+	if ratingChange.Valid {
+		session.RatingChange = &ratingChange.Float64
+	}
+	if deadline.Valid {
+		session.Deadline = &deadline.Time
+	}
+	if turnDeadline.Valid {
+		session.TurnDeadline = &turnDeadline.Time
+	}
+	if user2ID.Valid {
+		session.User2ID = &user2ID.Int64
+	}
+	session.User2Position = user2Position.String
+	if user2RatingChange.Valid {
+		session.User2RatingChange = &user2RatingChange.Float64
+	}
+	session.InviteCode = inviteCode.String
+	if createdBy.Valid {
+		session.CreatedBy = &createdBy.Int64
+	}
 
 	return &session, nil
 }
 
-// ディベートセッション更新
-func (d *DB) UpdateDebateSession(session *models.DebateSession) error {
+// サンプリングパラメータをJSONとして保存する値に変換（未指定ならNULL）
+func samplingJSON(params *models.SamplingParams) sql.NullString {
+	if params == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func parseSampling(value sql.NullString) *models.SamplingParams {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var params models.SamplingParams
+	if err := json.Unmarshal([]byte(value.String), &params); err != nil {
+		log.Printf("Warning: invalid sampling parameters: %v", err)
+		return nil
+	}
+	return &params
+}
+
+// 審査員パネルをJSONとして保存する値に変換（空ならNULL）
+func panelJSON(panel []models.JudgeSpec) sql.NullString {
+	if len(panel) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(panel)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func parsePanel(value sql.NullString) []models.JudgeSpec {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var panel []models.JudgeSpec
+	if err := json.Unmarshal([]byte(value.String), &panel); err != nil {
+		log.Printf("Warning: invalid judge panel: %v", err)
+		return nil
+	}
+	return panel
+}
+
+// ディベートセッション取得（チーム戦では参加者も含める）
+func (d *DB) GetDebateSession(id int64) (*models.DebateSession, error) {
+	session, err := scanSession(d.conn.QueryRow(
+		"SELECT "+sessionColumns+" FROM debate_sessions WHERE id = ?",
+		id,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if session.Mode == "team" {
+		if session.Participants, err = d.GetParticipants(id); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// 進行中のセッションのフェーズ・発言の順番・番の期限・パスの回数を保存（発言の順番がprevTurnIndexでなければfalse）
+// 状態と勝敗は書き込まず、終了したセッションは古いコピーで上書きしないよう更新しない
+// 同時に発言しても同じ番を2回使えないよう、発言の順番の確認と更新を1つの更新で行う
+func (d *DB) UpdateSessionProgress(session *models.DebateSession, prevTurnIndex int) (bool, error) {
+	result, err := d.conn.Exec(
+		`UPDATE debate_sessions SET current_phase = ?, turn_index = ?, turn_deadline = ?, passes = ?
+		WHERE id = ? AND status IN ('active', 'ongoing') AND turn_index = ?`,
+		nullString(session.CurrentPhase), session.TurnIndex, session.TurnDeadline, session.Passes, session.ID, prevTurnIndex,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// 進行中のセッションに終了する理由を記録（終了時の審査で使う）
+func (d *DB) SetEndReason(sessionID int64, reason string) error {
+	_, err := d.conn.Exec(
+		`UPDATE debate_sessions SET end_reason = ? WHERE id = ? AND status IN ('active', 'ongoing')`,
+		reason, sessionID,
+	)
+	return err
+}
+
+// 進行中のセッションを勝敗とともに終了する（すでに終了していればfalse）
+// 同時に終了させても勝敗を1回だけ記録できるよう、状態の確認と更新を1つの更新で行う
+func (d *DB) FinishDebateSession(session *models.DebateSession) (bool, error) {
 	var finishedAt interface{}
 	if session.FinishedAt != nil {
 		finishedAt = *session.FinishedAt
 	}
 
+	result, err := d.conn.Exec(
+		`UPDATE debate_sessions SET status = 'finished', winner = ?, judge_comment = ?, ended_at = ?, end_reason = ?,
+			position_bias = ?, turn_deadline = NULL
+		WHERE id = ? AND status IN ('active', 'ongoing')`,
+		session.Winner, session.JudgeComment, finishedAt, session.EndReason, session.PositionBias, session.ID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// 終了したセッションのレーティングの変動を保存
+func (d *DB) UpdateRatingChanges(session *models.DebateSession) error {
 	_, err := d.conn.Exec(
-		`UPDATE debate_sessions SET status = ?, winner = ?, judge_comment = ?, ended_at = ? WHERE id = ?`,
-		session.Status, session.Winner, session.JudgeComment, finishedAt, session.ID,
+		`UPDATE debate_sessions SET rating_change = ?, user2_rating_change = ? WHERE id = ?`,
+		session.RatingChange, session.User2RatingChange, session.ID,
 	)
 	return err
 }
 
-// メッセージ作成
-func (d *DB) CreateMessage(sessionID int64, role, content string) (*models.DebateMessage, error) {
+// 招待コードでセッションを取得
+func (d *DB) GetDebateSessionByInviteCode(code string) (*models.DebateSession, error) {
+	var id int64
+	if err := d.conn.QueryRow("SELECT id FROM debate_sessions WHERE invite_code = ?", code).Scan(&id); err != nil {
+		return nil, err
+	}
+	return d.GetDebateSession(id)
+}
+
+// 招待中のセッションに参加者を加えて開始する（すでに参加者がいればfalse）
+// 同時に参加しても1人だけが参加できるよう、状態の確認と更新を1つの更新で行う
+func (d *DB) JoinDebateSession(sessionID, userID int64, deadline *time.Time) (bool, error) {
+	result, err := d.conn.Exec(
+		`UPDATE debate_sessions SET user2_id = ?, status = 'active', deadline = ? WHERE id = ? AND status = 'waiting'`,
+		userID, deadline, sessionID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// 招待中のセッションを開始する（すでに開始していればfalse）
+func (d *DB) StartDebateSession(sessionID int64, deadline *time.Time) (bool, error) {
+	result, err := d.conn.Exec(
+		`UPDATE debate_sessions SET status = 'active', deadline = ? WHERE id = ? AND status = 'waiting'`,
+		deadline, sessionID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// チーム戦の参加者を作成
+func (d *DB) CreateParticipants(participants []models.Participant) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range participants {
+		if _, err := tx.Exec(
+			`INSERT INTO debate_participants (session_id, role, side, speaker_order, kind, user_id, provider, model)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.SessionID, p.Role, p.Side, p.SpeakerOrder, p.Kind, p.UserID, nullString(p.Provider), nullString(p.Model),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// セッションの参加者を発言する側と発言順の順に取得
+func (d *DB) GetParticipants(sessionID int64) ([]models.Participant, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, session_id, role, side, speaker_order, kind, user_id, provider, model, rating_change
+		FROM debate_participants WHERE session_id = ? ORDER BY side DESC, speaker_order ASC`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []models.Participant
+	for rows.Next() {
+		var p models.Participant
+		var userID sql.NullInt64
+		var provider, model sql.NullString
+		var ratingChange sql.NullFloat64
+		if err := rows.Scan(&p.ID, &p.SessionID, &p.Role, &p.Side, &p.SpeakerOrder, &p.Kind,
+			&userID, &provider, &model, &ratingChange); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			p.UserID = &userID.Int64
+		}
+		p.Provider = provider.String
+		p.Model = model.String
+		if ratingChange.Valid {
+			p.RatingChange = &ratingChange.Float64
+		}
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+// 招待中のセッションの空いている人間の枠にユーザーを加える（sideが空ならどちらの側でも、空きがなければfalse）
+// 同時に参加しても同じ枠や1人で複数の枠に入らないよう、空きと参加済みの確認と更新を1つの更新で行う
+func (d *DB) JoinParticipant(sessionID, userID int64, side string) (bool, error) {
+	result, err := d.conn.Exec(
+		`UPDATE debate_participants SET user_id = ? WHERE id = (
+			SELECT p.id FROM debate_participants p JOIN debate_sessions s ON p.session_id = s.id
+			WHERE p.session_id = ? AND s.status = 'waiting' AND p.kind = 'human' AND p.user_id IS NULL
+				AND (? = '' OR p.side = ?)
+				AND NOT EXISTS (SELECT 1 FROM debate_participants WHERE session_id = ? AND user_id = ?)
+			ORDER BY p.side DESC, p.speaker_order ASC LIMIT 1)`,
+		userID, sessionID, side, side, sessionID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// 参加者の終了時のレーティングの変動を記録
+func (d *DB) UpdateParticipantRating(participantID int64, change float64) error {
+	_, err := d.conn.Exec(`UPDATE debate_participants SET rating_change = ? WHERE id = ?`, change, participantID)
+	return err
+}
+
+// 持ち時間のある進行中のセッションを取得
+func (d *DB) GetTimedSessions() ([]models.DebateSession, error) {
+	rows, err := d.conn.Query(
+		"SELECT " + sessionColumns + ` FROM debate_sessions
+		WHERE status IN ('active', 'ongoing') AND (deadline IS NOT NULL OR turn_deadline IS NOT NULL)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.DebateSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// コーチのヒントを1回使ったものとして記録（使える回数が残っていなければfalse）
+// 同時に要求されても回数を超えないよう、残りの確認と記録を1つの更新で行う
+func (d *DB) UseHint(sessionID int64) (bool, error) {
+	result, err := d.conn.Exec(
+		`UPDATE debate_sessions SET hints_used = hints_used + 1 WHERE id = ? AND hints_used < hint_budget`,
+		sessionID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// LLMが生成したメッセージを、生成に使ったプロンプトのバージョンとともに作成
+func (d *DB) CreateGeneratedMessage(sessionID int64, role, content, promptVersion string) (*models.DebateMessage, error) {
+	return d.InsertMessage(&models.DebateMessage{SessionID: sessionID, Role: role, Content: content, PromptVersion: promptVersion})
+}
+
+// メッセージを要点・反論・プロンプトのバージョン・フェーズを含めて作成
+func (d *DB) InsertMessage(msg *models.DebateMessage) (*models.DebateMessage, error) {
+	var keyPoints sql.NullString
+	if msg.KeyPoints != nil {
+		data, err := json.Marshal(msg.KeyPoints)
+		if err != nil {
+			return nil, err
+		}
+		keyPoints = sql.NullString{String: string(data), Valid: true}
+	}
+
 	result, err := d.conn.Exec(
-		"INSERT INTO debate_messages (session_id, role, content) VALUES (?, ?, ?)",
-		sessionID, role, content,
+		`INSERT INTO debate_messages (session_id, role, content, key_points, counterpoint, prompt_version, phase, participant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.SessionID, msg.Role, msg.Content, keyPoints, nullString(msg.Counterpoint),
+		nullString(msg.PromptVersion), nullString(msg.Phase), msg.ParticipantID,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	id, _ := result.LastInsertId()
-	return &models.DebateMessage{
-		ID:        id,
-		SessionID: sessionID,
-		Role:      role,
-		Content:   content,
-		CreatedAt: time.Now(),
-	}, nil
+	created := *msg
+	created.ID = id
+	created.CreatedAt = time.Now()
+	return &created, nil
 }
 
-// セッションのメッセージ取得
+// 空文字列をNULLとして保存する値に変換
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// セッションのメッセージ取得（created_atは秒単位のため、同じ時刻の発言は保存した順に並べる）
 func (d *DB) GetSessionMessages(sessionID int64) ([]models.DebateMessage, error) {
 	rows, err := d.conn.Query(
-		"SELECT id, session_id, role, content, created_at FROM debate_messages WHERE session_id = ? ORDER BY created_at ASC",
+		`SELECT id, session_id, role, content, created_at, key_points, counterpoint, prompt_version, phase, participant_id
+		FROM debate_messages WHERE session_id = ? ORDER BY created_at ASC, id ASC`,
 		sessionID,
 	)
 	if err != nil {
@@ -233,9 +801,22 @@ func (d *DB) GetSessionMessages(sessionID int64) ([]models.DebateMessage, error)
 	var messages []models.DebateMessage
 	for rows.Next() {
 		var msg models.DebateMessage
-		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt); err != nil {
+		var keyPoints, counterpoint, promptVersion, phase sql.NullString
+		var participantID sql.NullInt64
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt, &keyPoints, &counterpoint, &promptVersion, &phase, &participantID); err != nil {
 			return nil, err
 		}
+		if keyPoints.Valid && keyPoints.String != "" {
+			if err := json.Unmarshal([]byte(keyPoints.String), &msg.KeyPoints); err != nil {
+				log.Printf("Warning: invalid key_points for message %d: %v", msg.ID, err)
+			}
+		}
+		msg.Counterpoint = counterpoint.String
+		msg.PromptVersion = promptVersion.String
+		msg.Phase = phase.String
+		if participantID.Valid {
+			msg.ParticipantID = &participantID.Int64
+		}
 		messages = append(messages, msg)
 	}
 	return messages, nil
@@ -246,9 +827,9 @@ func (d *DB) GetUserStats(userID int64) (*models.UserStats, error) {
 	var stats models.UserStats
 	var id int64
 	err := d.conn.QueryRow(
-		"SELECT id, user_id, total_debates, wins, losses, draws FROM user_stats WHERE user_id = ?",
+		"SELECT id, user_id, total_debates, wins, losses, draws, rating, assisted_wins FROM user_stats WHERE user_id = ?",
 		userID,
-	).Scan(&id, &stats.UserID, &stats.TotalDebates, &stats.Wins, &stats.Losses, &stats.Draws)
+	).Scan(&id, &stats.UserID, &stats.TotalDebates, &stats.Wins, &stats.Losses, &stats.Draws, &stats.Rating, &stats.AssistedWins)
 	if err != nil {
 		return nil, err
 	}
@@ -258,8 +839,8 @@ func (d *DB) GetUserStats(userID int64) (*models.UserStats, error) {
 // ユーザー統計更新
 func (d *DB) UpdateUserStats(stats *models.UserStats) error {
 	_, err := d.conn.Exec(
-		`UPDATE user_stats SET total_debates = ?, wins = ?, losses = ?, draws = ? WHERE user_id = ?`,
-		stats.TotalDebates, stats.Wins, stats.Losses, stats.Draws, stats.UserID,
+		`UPDATE user_stats SET total_debates = ?, wins = ?, losses = ?, draws = ?, rating = ?, assisted_wins = ? WHERE user_id = ?`,
+		stats.TotalDebates, stats.Wins, stats.Losses, stats.Draws, stats.Rating, stats.AssistedWins, stats.UserID,
 	)
 	return err
 }
@@ -267,9 +848,10 @@ func (d *DB) UpdateUserStats(stats *models.UserStats) error {
 // ユーザーのディベート履歴取得
 func (d *DB) GetUserDebateHistory(userID int64) ([]models.DebateSession, error) {
 	rows, err := d.conn.Query(
-		`SELECT id, user_id, mode, topic, user_position, status, winner, judge_comment, created_at, ended_at 
-		FROM debate_sessions WHERE user_id = ? ORDER BY created_at DESC`,
-		userID,
+		"SELECT "+sessionColumns+` FROM debate_sessions
+		WHERE user_id = ? OR user2_id = ? OR id IN (SELECT session_id FROM debate_participants WHERE user_id = ?)
+		ORDER BY created_at DESC`,
+		userID, userID, userID,
 	)
 	if err != nil {
 		return nil, err
@@ -278,35 +860,497 @@ func (d *DB) GetUserDebateHistory(userID int64) ([]models.DebateSession, error)
 
 	var sessions []models.DebateSession
 	for rows.Next() {
-		var session models.DebateSession
-		var userIDVal sql.NullInt64
-		var userPosition sql.NullString
-		var winner sql.NullString
-		var judgeComment sql.NullString
-		var finishedAt sql.NullTime
-
-		if err := rows.Scan(&session.ID, &userIDVal, &session.Mode, &session.Topic, &userPosition,
-			&session.Status, &winner, &judgeComment, &session.CreatedAt, &finishedAt); err != nil {
+		session, err := scanSession(rows)
+		if err != nil {
 			return nil, err
 		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
 
-		if userIDVal.Valid {
-			session.UserID = &userIDVal.Int64
+// LLM使用量の記録
+func (d *DB) CreateUsageRecord(sessionID *int64, role, model string, promptTokens, completionTokens int64, cost float64) error {
+	_, err := d.conn.Exec(
+		`INSERT INTO llm_usage (session_id, role, model, prompt_tokens, completion_tokens, cost)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sessionID, role, model, promptTokens, completionTokens, cost,
+	)
+	return err
+}
+
+// セッションのLLM使用量を役割ごとに集計
+func (d *DB) GetSessionUsage(sessionID int64) (*models.SessionUsage, error) {
+	rows, err := d.conn.Query(
+		`SELECT role, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM llm_usage WHERE session_id = ? GROUP BY role`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &models.SessionUsage{ByRole: map[string]models.TokenUsage{}}
+	for rows.Next() {
+		var role string
+		var u models.TokenUsage
+		if err := rows.Scan(&role, &u.Calls, &u.PromptTokens, &u.CompletionTokens, &u.Cost); err != nil {
+			return nil, err
 		}
-		if userPosition.Valid {
-			session.UserPosition = userPosition.String
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		usage.ByRole[role] = u
+		addTokenUsage(&usage.Total, u)
+	}
+	return usage, rows.Err()
+}
+
+// ユーザーのLLM使用量をディベートモードごとに集計（ユーザーが作成したセッションが対象）
+func (d *DB) GetUserUsage(userID int64) (*models.UserUsage, error) {
+	rows, err := d.conn.Query(
+		`SELECT s.mode, COUNT(*), COALESCE(SUM(u.prompt_tokens), 0), COALESCE(SUM(u.completion_tokens), 0), COALESCE(SUM(u.cost), 0)
+		FROM llm_usage u JOIN debate_sessions s ON u.session_id = s.id
+		WHERE COALESCE(s.created_by, s.user_id) = ? GROUP BY s.mode`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := &models.UserUsage{UserID: userID, ByMode: map[string]models.TokenUsage{}}
+	for rows.Next() {
+		var mode string
+		var u models.TokenUsage
+		if err := rows.Scan(&mode, &u.Calls, &u.PromptTokens, &u.CompletionTokens, &u.Cost); err != nil {
+			return nil, err
 		}
-		if winner.Valid {
-			session.Winner = &winner.String
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		usage.ByMode[mode] = u
+		addTokenUsage(&usage.Total, u)
+	}
+	return usage, rows.Err()
+}
+
+// セッションの議論要約を取得（未作成の場合はnil）
+func (d *DB) GetSessionSummary(sessionID int64) (*models.SessionSummary, error) {
+	var summary models.SessionSummary
+	err := d.conn.QueryRow(
+		"SELECT session_id, through_message_id, content, updated_at FROM debate_summaries WHERE session_id = ?",
+		sessionID,
+	).Scan(&summary.SessionID, &summary.ThroughMessageID, &summary.Content, &summary.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// セッションの議論要約を保存（既存の要約は置き換える）
+func (d *DB) SaveSessionSummary(summary *models.SessionSummary) error {
+	_, err := d.conn.Exec(
+		`INSERT INTO debate_summaries (session_id, through_message_id, content, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(session_id) DO UPDATE SET
+			through_message_id = excluded.through_message_id,
+			content = excluded.content,
+			updated_at = excluded.updated_at`,
+		summary.SessionID, summary.ThroughMessageID, summary.Content,
+	)
+	return err
+}
+
+func addTokenUsage(total *models.TokenUsage, u models.TokenUsage) {
+	total.Calls += u.Calls
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.TotalTokens += u.TotalTokens
+	total.Cost += u.Cost
+}
+
+// 審査結果をまとめて保存
+func (d *DB) CreateJudgeResults(results []models.JudgeResult) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range results {
+		if err := insertJudgeResult(tx, r); err != nil {
+			return err
 		}
-		if judgeComment.Valid {
-			session.JudgeComment = &judgeComment.String
+	}
+	return tx.Commit()
+}
+
+func insertJudgeResult(tx *sql.Tx, r models.JudgeResult) error {
+	var createdAt any
+	if !r.CreatedAt.IsZero() {
+		createdAt = r.CreatedAt
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO judge_results (session_id, kind, judge_provider, judge_model, persona, prompt_version,
+			winner, pro_score, con_score, reasoning, pro_strengths, pro_weaknesses, con_strengths, con_weaknesses,
+			final_comment, swapped, hints_used, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`,
+		r.SessionID, r.Kind, nullString(r.JudgeProvider), nullString(r.JudgeModel), nullString(r.Persona),
+		nullString(r.PromptVersion), r.Winner, r.Score.Pro, r.Score.Con, r.Reasoning,
+		stringsJSON(r.ProStrengths), stringsJSON(r.ProWeaknesses), stringsJSON(r.ConStrengths), stringsJSON(r.ConWeaknesses),
+		r.FinalComment, r.Swapped, r.HintsUsed, createdAt,
+	)
+	return err
+}
+
+// セッションの審査結果を取得（集計した判定、審査員ごとの判定の順）
+func (d *DB) GetJudgeResults(sessionID int64) ([]models.JudgeResult, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, session_id, kind, judge_provider, judge_model, persona, prompt_version,
+			winner, pro_score, con_score, reasoning, pro_strengths, pro_weaknesses, con_strengths, con_weaknesses,
+			final_comment, swapped, COALESCE(hints_used, 0), created_at
+		FROM judge_results WHERE session_id = ? ORDER BY kind = 'ballot', id`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.JudgeResult
+	for rows.Next() {
+		var r models.JudgeResult
+		var provider, model, persona, promptVersion sql.NullString
+		var reasoning, finalComment sql.NullString
+		var proStrengths, proWeaknesses, conStrengths, conWeaknesses sql.NullString
+		if err := rows.Scan(&r.ID, &r.SessionID, &r.Kind, &provider, &model, &persona, &promptVersion,
+			&r.Winner, &r.Score.Pro, &r.Score.Con, &reasoning,
+			&proStrengths, &proWeaknesses, &conStrengths, &conWeaknesses,
+			&finalComment, &r.Swapped, &r.HintsUsed, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.JudgeProvider = provider.String
+		r.JudgeModel = model.String
+		r.Persona = persona.String
+		r.PromptVersion = promptVersion.String
+		r.Reasoning = reasoning.String
+		r.FinalComment = finalComment.String
+		r.ProStrengths = parseStrings(proStrengths)
+		r.ProWeaknesses = parseStrings(proWeaknesses)
+		r.ConStrengths = parseStrings(conStrengths)
+		r.ConWeaknesses = parseStrings(conWeaknesses)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// 文字列の配列をJSONとして保存する値に変換
+func stringsJSON(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func parseStrings(value sql.NullString) []string {
+	values := []string{}
+	if value.Valid && value.String != "" {
+		if err := json.Unmarshal([]byte(value.String), &values); err != nil {
+			log.Printf("Warning: invalid string list: %v", err)
 		}
-		if finishedAt.Valid {
-			session.FinishedAt = &finishedAt.Time
+	}
+	return values
+}
+
+// 以前はdebate_messagesにJSONとして保存していた審査結果をjudge_resultsへ移す
+func (d *DB) migrateJudgeMessages() error {
+	rows, err := d.conn.Query(
+		`SELECT m.session_id, m.role, m.content, m.prompt_version, m.created_at, s.judge_provider, s.judge_model, s.judge_panel
+		FROM debate_messages m JOIN debate_sessions s ON s.id = m.session_id
+		WHERE m.role IN ('judge', 'judge_ballot') ORDER BY m.id`,
+	)
+	if err != nil {
+		return err
+	}
+
+	var results []models.JudgeResult
+	found := false
+	for rows.Next() {
+		found = true
+		var r models.JudgeResult
+		var role, content string
+		var promptVersion, provider, model, panel sql.NullString
+		if err := rows.Scan(&r.SessionID, &role, &content, &promptVersion, &r.CreatedAt, &provider, &model, &panel); err != nil {
+			rows.Close()
+			return err
 		}
+		r.PromptVersion = promptVersion.String
 
-		sessions = append(sessions, session)
+		if role == "judge_ballot" {
+			var ballot models.JudgeBallot
+			if err := json.Unmarshal([]byte(content), &ballot); err != nil || ballot.Result == nil {
+				log.Printf("Warning: skipping invalid judge ballot of session %d", r.SessionID)
+				continue
+			}
+			r.Kind = "ballot"
+			r.JudgeProvider = ballot.Judge.Provider
+			r.JudgeModel = ballot.Judge.Model
+			r.Persona = ballot.Judge.Persona
+			r.JudgeResponse = *ballot.Result
+		} else {
+			if err := json.Unmarshal([]byte(content), &r.JudgeResponse); err != nil {
+				log.Printf("Warning: skipping invalid judge result of session %d", r.SessionID)
+				continue
+			}
+			r.Kind = "verdict"
+			if len(parsePanel(panel)) <= 1 {
+				r.JudgeProvider = provider.String
+				r.JudgeModel = model.String
+			}
+		}
+		results = append(results, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range results {
+		if err := insertJudgeResult(tx, r); err != nil {
+			return fmt.Errorf("failed to migrate judge results: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM debate_messages WHERE role IN ('judge', 'judge_ballot')`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 位置バイアスの確認結果を集計
+// 全体はディベートごとの判定の食い違い、モデルごとの内訳は審査員ごとの判定（入れ替えていない判定と入れ替えた判定の組）の食い違い
+// 同じ審査員が同じセッションで複数いる場合は、保存した順番で組にする
+func (d *DB) GetBiasStats() (*models.BiasStats, error) {
+	stats := &models.BiasStats{ByJudgeModel: map[string]models.BiasCount{}}
+	if err := d.conn.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(position_bias), 0) FROM debate_sessions WHERE position_bias IS NOT NULL`,
+	).Scan(&stats.Checked, &stats.Biased); err != nil {
+		return nil, err
+	}
+	stats.Rate = biasRate(stats.Biased, stats.Checked)
+
+	rows, err := d.conn.Query(
+		`WITH ballots AS (
+			SELECT session_id, COALESCE(judge_provider, '') AS provider, COALESCE(judge_model, '') AS model,
+				COALESCE(persona, '') AS persona, swapped, winner,
+				ROW_NUMBER() OVER (PARTITION BY session_id, judge_provider, judge_model, persona, swapped ORDER BY id) AS n
+			FROM judge_results WHERE kind = 'ballot'
+		)
+		SELECT a.model, COUNT(*), COALESCE(SUM(a.winner != b.winner), 0)
+		FROM ballots a JOIN ballots b
+			ON a.session_id = b.session_id AND a.provider = b.provider AND a.model = b.model
+			AND a.persona = b.persona AND a.n = b.n
+		WHERE a.swapped = 0 AND b.swapped = 1
+		GROUP BY a.model`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var model string
+		var c models.BiasCount
+		if err := rows.Scan(&model, &c.Checked, &c.Biased); err != nil {
+			return nil, err
+		}
+		c.Rate = biasRate(c.Biased, c.Checked)
+		stats.ByJudgeModel[model] = c
+	}
+	return stats, rows.Err()
+}
+
+func biasRate(biased, checked int) float64 {
+	if checked == 0 {
+		return 0
+	}
+	return float64(biased) / float64(checked)
+}
+
+// ペルソナごとの戦績を集計（終了した user_vs_llm のディベートでのAIから見た勝敗）
+func (d *DB) GetPersonaRecords() (map[string]models.PersonaInfo, error) {
+	rows, err := d.conn.Query(
+		`SELECT persona,
+			COALESCE(SUM(CASE WHEN winner = 'llm' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN winner = 'user' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN winner = 'draw' THEN 1 ELSE 0 END), 0)
+		FROM debate_sessions
+		WHERE mode = 'user_vs_llm' AND status = 'finished' AND persona IS NOT NULL
+		GROUP BY persona`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := map[string]models.PersonaInfo{}
+	for rows.Next() {
+		var r models.PersonaInfo
+		if err := rows.Scan(&r.Name, &r.Wins, &r.Losses, &r.Draws); err != nil {
+			return nil, err
+		}
+		records[r.Name] = r
+	}
+	return records, rows.Err()
+}
+
+// 発言のファクトチェックの結果をまとめて保存
+func (d *DB) CreateFactChecks(checks []models.FactCheck) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range checks {
+		if _, err := tx.Exec(
+			`INSERT INTO fact_checks (session_id, message_id, claim, rating, note, prompt_version)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			c.SessionID, c.MessageID, c.Claim, c.Rating, nullString(c.Note), nullString(c.PromptVersion),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// セッションのファクトチェックの結果を取得（メッセージIDごと）
+func (d *DB) GetFactChecks(sessionID int64) (map[int64][]models.FactCheck, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, session_id, message_id, claim, rating, note, prompt_version, created_at
+		FROM fact_checks WHERE session_id = ? ORDER BY id`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := map[int64][]models.FactCheck{}
+	for rows.Next() {
+		var c models.FactCheck
+		var note, promptVersion sql.NullString
+		if err := rows.Scan(&c.ID, &c.SessionID, &c.MessageID, &c.Claim, &c.Rating, &note, &promptVersion, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Note = note.String
+		c.PromptVersion = promptVersion.String
+		checks[c.MessageID] = append(checks[c.MessageID], c)
+	}
+	return checks, rows.Err()
+}
+
+// 終了後のフィードバックを保存
+func (d *DB) CreateFeedbackReport(report *models.FeedbackReport) error {
+	result, err := d.conn.Exec(
+		`INSERT INTO feedback_reports (session_id, user_id, summary, turns, missed_rebuttals, fallacies,
+			practice_topics, weaknesses, prompt_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.SessionID, report.UserID, report.Summary,
+		listJSON(report.Turns), listJSON(report.MissedRebuttals), listJSON(report.Fallacies),
+		stringsJSON(report.PracticeTopics), stringsJSON(report.Weaknesses), nullString(report.PromptVersion),
+	)
+	if err != nil {
+		return err
+	}
+	report.ID, _ = result.LastInsertId()
+	report.CreatedAt = time.Now()
+	return nil
+}
+
+// feedback_reportsから取得するカラム（scanFeedbackReportと順序を合わせる）
+const feedbackColumns = `id, session_id, user_id, summary, turns, missed_rebuttals, fallacies,
+	practice_topics, weaknesses, prompt_version, created_at`
+
+func scanFeedbackReport(row rowScanner) (*models.FeedbackReport, error) {
+	var r models.FeedbackReport
+	var userID sql.NullInt64
+	var summary, turns, missed, fallacies, practiceTopics, weaknesses, promptVersion sql.NullString
+	if err := row.Scan(&r.ID, &r.SessionID, &userID, &summary, &turns, &missed, &fallacies,
+		&practiceTopics, &weaknesses, &promptVersion, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		r.UserID = &userID.Int64
+	}
+	r.Summary = summary.String
+	r.Turns = []models.TurnFeedback{}
+	parseList(turns, &r.Turns)
+	r.MissedRebuttals = []models.MissedRebuttal{}
+	parseList(missed, &r.MissedRebuttals)
+	r.Fallacies = []models.Fallacy{}
+	parseList(fallacies, &r.Fallacies)
+	r.PracticeTopics = parseStrings(practiceTopics)
+	r.Weaknesses = parseStrings(weaknesses)
+	r.PromptVersion = promptVersion.String
+	return &r, nil
+}
+
+// セッションのフィードバックを取得
+func (d *DB) GetFeedbackReport(sessionID int64) (*models.FeedbackReport, error) {
+	return scanFeedbackReport(d.conn.QueryRow(
+		`SELECT `+feedbackColumns+` FROM feedback_reports WHERE session_id = ?`,
+		sessionID,
+	))
+}
+
+// ユーザーのフィードバックを新しい順に取得
+func (d *DB) GetUserFeedbackReports(userID int64) ([]models.FeedbackReport, error) {
+	rows, err := d.conn.Query(
+		`SELECT `+feedbackColumns+` FROM feedback_reports WHERE user_id = ? ORDER BY created_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.FeedbackReport
+	for rows.Next() {
+		r, err := scanFeedbackReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *r)
+	}
+	return reports, rows.Err()
+}
+
+// 構造体の配列をJSONとして保存する値に変換
+func listJSON(values any) string {
+	data, err := json.Marshal(values)
+	if err != nil || string(data) == "null" {
+		return "[]"
+	}
+	return string(data)
+}
+
+func parseList(value sql.NullString, dest any) {
+	if !value.Valid || value.String == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(value.String), dest); err != nil {
+		log.Printf("Warning: invalid list: %v", err)
 	}
-	return sessions, nil
 }
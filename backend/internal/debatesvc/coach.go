@@ -0,0 +1,135 @@
+package debatesvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+)
+
+// セッションごとに指定できるヒントの回数の上限
+const maxHintBudget = 10
+
+// 1回のヒントで返す切り口の数の上限
+const maxHints = 3
+
+// ヒントを使い切ったセッションでヒントを要求したときのエラー（APIでは409として扱う）
+var ErrHintLimit = errors.New("hint budget exhausted")
+
+// セッション作成時にヒントの回数を決定（user_vs_llm 以外では0）
+func (s *Service) resolveHintBudget(mode string, budget *int) (int, error) {
+	if mode != "user_vs_llm" {
+		if budget != nil && *budget > 0 {
+			return 0, fmt.Errorf("hints are only available in user_vs_llm mode")
+		}
+		return 0, nil
+	}
+	if budget == nil {
+		return s.config.HintBudget, nil
+	}
+	if *budget < 0 || *budget > maxHintBudget {
+		return 0, fmt.Errorf("hint_budget must be between 0 and %d", maxHintBudget)
+	}
+	return *budget, nil
+}
+
+// ユーザーの番にコーチがこれまでの議論を読み、反論の切り口や相手の主張の弱点を提案する
+// 提案を返せた場合のみヒントを1回使ったものとして記録する（セッションのユーザー本人のみ）
+func (s *Service) GetHint(ctx context.Context, sessionID, userID int64) (*models.HintResponse, error) {
+	session, err := s.database.GetDebateSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+
+	if session.Mode != "user_vs_llm" {
+		return nil, fmt.Errorf("%w: hints are only available in user_vs_llm mode", ErrInvalidRequest)
+	}
+	if _, err := participantRole(session, userID); err != nil {
+		return nil, err
+	}
+	if session.Status != "active" && session.Status != "ongoing" {
+		return nil, fmt.Errorf("debate has already ended")
+	}
+	if _, err := s.expectTurn(session, "user"); err != nil {
+		return nil, err
+	}
+	if session.HintsUsed >= session.HintBudget {
+		return nil, fmt.Errorf("%w: %d of %d hints used", ErrHintLimit, session.HintsUsed, session.HintBudget)
+	}
+
+	messages, err := s.database.GetSessionMessages(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	assignPositions(session)
+
+	hints, err := s.askCoach(ctx, session, messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hints: %w", err)
+	}
+
+	ok, err := s.database.UseHint(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record hint usage: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %d of %d hints used", ErrHintLimit, session.HintBudget, session.HintBudget)
+	}
+
+	used := session.HintsUsed + 1
+	return &models.HintResponse{
+		Hints:          hints,
+		HintsUsed:      used,
+		HintsRemaining: session.HintBudget - used,
+	}, nil
+}
+
+// コーチLLMにユーザーの立場からのヒントを問い合わせる
+func (s *Service) askCoach(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage) ([]models.Hint, error) {
+	provider, err := s.providerFor(session, "coach")
+	if err != nil {
+		return nil, err
+	}
+
+	lang := sessionLanguage(session.Language)
+	data := coachPromptData{Topic: session.Topic, Position: session.UserPosition}
+	prompt, err := s.config.Prompts.Render(lang, "coach", data)
+	if err != nil {
+		return nil, err
+	}
+	data.Transcript = s.transcript(ctx, session, messages, s.config.JudgeContextTokens-llm.EstimateTokens(prompt.System+prompt.User))
+	if prompt, err = s.config.Prompts.Render(lang, "coach", data); err != nil {
+		return nil, err
+	}
+
+	coachMessages := []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, coachMessages, s.samplingFor(session, "coach"), s.schemaFor(session.Language, "coach_hints", openai.CoachHintsSchema))
+	if err != nil {
+		s.recordUsage(&session.ID, "coach", llm.UsageOf(err))
+		return nil, err
+	}
+	s.recordUsage(&session.ID, "coach", response.Usage)
+
+	var result struct {
+		Hints []models.Hint `json:"hints"`
+	}
+	if err := json.Unmarshal([]byte(response.Content), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse coach response: %w", err)
+	}
+	if len(result.Hints) > maxHints {
+		result.Hints = result.Hints[:maxHints]
+	}
+	if result.Hints == nil {
+		result.Hints = []models.Hint{}
+	}
+	return result.Hints, nil
+}
@@ -0,0 +1,74 @@
+package debatesvc
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// user_vs_llm で難易度を指定しない場合の難易度
+const defaultDifficulty = "normal"
+
+// user_vs_llm の難易度（反論の厳しさや手法の指示はdifficultyテンプレートの同名のブロック）
+type difficultyLevel struct {
+	ReplyChars int     // 回答の目安の文字数（英語では半分の語数）
+	Rating     float64 // レーティングの計算で使うAIの強さ
+}
+
+var difficultyLevels = map[string]difficultyLevel{
+	"easy":   {ReplyChars: 200, Rating: 1000},
+	"normal": {ReplyChars: 300, Rating: 1200},
+	"hard":   {ReplyChars: 400, Rating: 1400},
+	"expert": {ReplyChars: 500, Rating: 1600},
+}
+
+// 難易度ごとに使うAI討論者のモデル
+type ModelChoice struct {
+	Provider string
+	Model    string
+}
+
+// 1戦ごとのレーティングの変動の大きさ（初期値1200はuser_statsの既定値）
+const ratingK = 32
+
+func validateDifficulty(mode, difficulty string) error {
+	if difficulty == "" {
+		return nil
+	}
+	if mode != "user_vs_llm" {
+		return fmt.Errorf("difficulty is only available in user_vs_llm mode")
+	}
+	if _, ok := difficultyLevels[difficulty]; !ok {
+		return fmt.Errorf("unknown difficulty %q (easy, normal, hard or expert)", difficulty)
+	}
+	return nil
+}
+
+// セッションの難易度（llm_vs_llm や古いセッションは標準）
+func difficultyOf(session *models.DebateSession) difficultyLevel {
+	if level, ok := difficultyLevels[session.Difficulty]; ok {
+		return level
+	}
+	return difficultyLevels[defaultDifficulty]
+}
+
+// 難易度に応じた討論者への指示（標準の難易度など、テンプレートにブロックがなければ空）
+func (s *Service) difficultyPrompt(session *models.DebateSession) (string, error) {
+	lang := sessionLanguage(session.Language)
+	if session.Difficulty == "" || !s.config.Prompts.HasBlock(lang, "difficulty", session.Difficulty) {
+		return "", nil
+	}
+	return s.config.Prompts.RenderBlock(lang, "difficulty", session.Difficulty, nil)
+}
+
+// 難易度に応じたAIの強さと対戦結果（勝ち1・引き分け0.5・負け0）からレーティングを更新
+func updateRating(rating float64, session *models.DebateSession, score float64) float64 {
+	return eloRating(rating, difficultyOf(session).Rating, score)
+}
+
+// 相手のレーティングと対戦結果からEloレーティングを更新
+func eloRating(rating, opponent, score float64) float64 {
+	expected := 1 / (1 + math.Pow(10, (opponent-rating)/400))
+	return rating + ratingK*(score-expected)
+}
@@ -0,0 +1,63 @@
+package debatesvc
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/db"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// テスト用の環境（一時ファイルのデータベース・ユーザーalice・偽プロバイダのサービス）
+// 外部テストパッケージからも使えるよう公開する
+type TestEnv struct {
+	DB      *db.DB
+	Service *Service
+	User    *models.User
+}
+
+// providerがnilの場合は台本どおりに応答する偽プロバイダを使う
+func NewTestEnv(t *testing.T, provider llm.Provider) *TestEnv {
+	t.Helper()
+
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "debate.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	user, err := database.CreateUser("alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	return &TestEnv{
+		DB:      database,
+		Service: NewService(database, fakeRegistry(provider), Config{}),
+		User:    user,
+	}
+}
+
+// ユーザーを追加してIDを返す
+func (e *TestEnv) AddUser(t *testing.T, name string) int64 {
+	t.Helper()
+	user, err := e.DB.CreateUser(name, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+// 偽プロバイダを既定のプロバイダとするレジストリ（nilの場合はモデルごとに台本モードの偽プロバイダ）
+func fakeRegistry(provider llm.Provider) *llm.Registry {
+	registry := llm.NewRegistry("fake", "fake-model")
+	registry.Register("fake", func(model string) (llm.Provider, error) {
+		if provider == nil {
+			return fakellm.NewScripted(nil), nil
+		}
+		return provider, nil
+	})
+	return registry
+}
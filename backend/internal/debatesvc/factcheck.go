@@ -0,0 +1,196 @@
+package debatesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+)
+
+// ファクトチェックの評価
+const (
+	ratingPlausible    = "plausible"
+	ratingDubious      = "dubious"
+	ratingUnverifiable = "unverifiable"
+)
+
+// 1回のファクトチェックにかける時間の上限（審査がファクトチェックの完了を待つため）
+const factCheckTimeout = 2 * time.Minute
+
+// セッションごとの実行中のファクトチェック（審査の前に完了を待つ）
+// セッションの終わり方によらず、実行中のものがなくなった時点でセッションの記録を消す
+type pendingChecks struct {
+	mu       sync.Mutex
+	sessions map[int64]*sessionChecks
+	// 1回のファクトチェックにかける時間の上限（0ならfactCheckTimeout、テストで短くする）
+	timeout time.Duration
+}
+
+type sessionChecks struct {
+	wg      sync.WaitGroup
+	running int
+}
+
+func (p *pendingChecks) add(sessionID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions == nil {
+		p.sessions = map[int64]*sessionChecks{}
+	}
+	checks, ok := p.sessions[sessionID]
+	if !ok {
+		checks = &sessionChecks{}
+		p.sessions[sessionID] = checks
+	}
+	checks.running++
+	checks.wg.Add(1)
+}
+
+func (p *pendingChecks) done(sessionID int64) {
+	p.mu.Lock()
+	checks := p.sessions[sessionID]
+	checks.running--
+	if checks.running == 0 {
+		delete(p.sessions, sessionID)
+	}
+	p.mu.Unlock()
+	checks.wg.Done()
+}
+
+func (p *pendingChecks) limit() time.Duration {
+	if p.timeout > 0 {
+		return p.timeout
+	}
+	return factCheckTimeout
+}
+
+// セッションの実行中のファクトチェックがすべて終わるまで待つ
+func (p *pendingChecks) wait(sessionID int64) {
+	p.mu.Lock()
+	checks, ok := p.sessions[sessionID]
+	p.mu.Unlock()
+	if ok {
+		checks.wg.Wait()
+	}
+}
+
+// 保存した発言のファクトチェックをバックグラウンドで始める（ファクトチェックしないセッションでは何もしない）
+// 応答を待たせないよう発言の保存とは独立して行い、失敗してもディベートは続ける
+func (s *Service) startFactCheck(ctx context.Context, session *models.DebateSession, msg *models.DebateMessage) {
+	if !session.FactCheck {
+		return
+	}
+
+	snapshot := *session
+	s.factChecks.add(session.ID)
+	go func() {
+		defer s.factChecks.done(session.ID)
+		// リクエストが終わっても続けるが、プロバイダが応答しない場合に審査を待たせ続けないよう時間を区切る
+		checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.factChecks.limit())
+		defer cancel()
+		if err := s.factCheck(checkCtx, &snapshot, msg); err != nil {
+			log.Printf("Fact check failed for message %d: %v", msg.ID, err)
+		}
+	}()
+}
+
+// 発言に含まれる事実についての主張をLLMに確認させて保存
+func (s *Service) factCheck(ctx context.Context, session *models.DebateSession, msg *models.DebateMessage) error {
+	provider, err := s.providerFor(session, "factcheck")
+	if err != nil {
+		return err
+	}
+
+	prompt, err := s.config.Prompts.Render(sessionLanguage(session.Language), "factcheck", factCheckPromptData{
+		Topic:     session.Topic,
+		Statement: msg.Content,
+	})
+	if err != nil {
+		return err
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, messages, s.samplingFor(session, "factcheck"), s.schemaFor(session.Language, "fact_check", openai.FactCheckSchema))
+	if err != nil {
+		s.recordUsage(&session.ID, "factcheck", llm.UsageOf(err))
+		return err
+	}
+	s.recordUsage(&session.ID, "factcheck", response.Usage)
+
+	var result models.FactCheckResponse
+	if err := json.Unmarshal([]byte(response.Content), &result); err != nil {
+		return fmt.Errorf("failed to parse fact check response: %w", err)
+	}
+
+	checks := make([]models.FactCheck, 0, len(result.Claims))
+	for _, c := range result.Claims {
+		if strings.TrimSpace(c.Claim) == "" {
+			continue
+		}
+		switch c.Rating {
+		case ratingPlausible, ratingDubious, ratingUnverifiable:
+		default:
+			c.Rating = ratingUnverifiable
+		}
+		checks = append(checks, models.FactCheck{
+			SessionID:     session.ID,
+			MessageID:     msg.ID,
+			Claim:         c.Claim,
+			Rating:        c.Rating,
+			Note:          c.Note,
+			PromptVersion: prompt.Version,
+		})
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+	return s.database.CreateFactChecks(checks)
+}
+
+// 発言にファクトチェックの結果を付ける
+func (s *Service) attachFactChecks(sessionID int64, messages []models.DebateMessage) error {
+	checks, err := s.database.GetFactChecks(sessionID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].FactChecks = checks[messages[i].ID]
+	}
+	return nil
+}
+
+// 審査員に渡すファクトチェックの結果（結果がなければ空）
+// 立場を入れ替えて審査する場合は、発言者の表記も入れ替える
+func (s *Service) factCheckNotes(session *models.DebateSession, messages []models.DebateMessage, swapped bool) string {
+	if swapped {
+		session, messages = swapSides(session, messages)
+	}
+
+	text := textFor(sessionLanguage(session.Language))
+	ratings := map[string]string{
+		ratingPlausible:    text.Plausible,
+		ratingDubious:      text.Dubious,
+		ratingUnverifiable: text.Unverifiable,
+	}
+
+	var notes strings.Builder
+	for _, msg := range messages {
+		for _, c := range msg.FactChecks {
+			fmt.Fprintf(&notes, "- %s: %s [%s] %s\n", speakerLabel(session, msg.Role), c.Claim, ratings[c.Rating], c.Note)
+		}
+	}
+	if notes.Len() == 0 {
+		return ""
+	}
+	return text.FactChecks + notes.String()
+}
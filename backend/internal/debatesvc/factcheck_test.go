@@ -0,0 +1,171 @@
+package debatesvc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// ファクトチェックに応答せず、打ち切られた理由を記録するプロバイダ
+type hangingProvider struct {
+	*fakellm.Scripted
+	errs chan error
+}
+
+func (p *hangingProvider) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	<-ctx.Done()
+	p.errs <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// 待ち終わるまでの上限を付けて、セッションの実行中のファクトチェックを待つ
+func waitChecks(t *testing.T, p *pendingChecks, sessionID int64) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		p.wait(sessionID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait for session %d did not return", sessionID)
+	}
+}
+
+func TestPendingChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		adds  []int64
+		dones []int64
+		want  map[int64]int // 残っているセッションごとの実行中の数
+	}{
+		{"single check", []int64{1}, []int64{1}, map[int64]int{}},
+		{"one of two running", []int64{1, 1}, []int64{1}, map[int64]int{1: 1}},
+		{"sessions are separate", []int64{1, 2}, []int64{2}, map[int64]int{1: 1}},
+		{"all finished", []int64{1, 2, 1}, []int64{1, 2, 1}, map[int64]int{}},
+		{"nothing started", nil, nil, map[int64]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p pendingChecks
+			for _, id := range tt.adds {
+				p.add(id)
+			}
+			for _, id := range tt.dones {
+				p.done(id)
+			}
+
+			// 実行中のものがなくなったセッションの記録は消える
+			if len(p.sessions) != len(tt.want) {
+				t.Errorf("%d sessions tracked, want %d", len(p.sessions), len(tt.want))
+			}
+			for id, running := range tt.want {
+				if checks := p.sessions[id]; checks == nil || checks.running != running {
+					t.Errorf("session %d: %+v, want %d running", id, checks, running)
+				}
+			}
+
+			// 実行中のものがないセッションはすぐに待ち終わる
+			for _, id := range []int64{1, 2, 3} {
+				if _, ok := tt.want[id]; !ok {
+					waitChecks(t, &p, id)
+				}
+			}
+		})
+	}
+}
+
+// 同時に登録・完了しても数え漏れがなく、すべて完了するまで待ち、完了後は記録が残らない
+func TestPendingChecksConcurrent(t *testing.T) {
+	var p pendingChecks
+	release := make(chan struct{})
+	var added, finished sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		id := int64(i%3 + 1)
+		added.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			p.add(id)
+			added.Done()
+			<-release
+			p.done(id)
+		}()
+	}
+	added.Wait()
+
+	waited := make(chan int64, 3)
+	for _, id := range []int64{1, 2, 3} {
+		go func() {
+			p.wait(id)
+			waited <- id
+		}()
+	}
+	select {
+	case id := <-waited:
+		t.Fatalf("wait for session %d returned while checks were running", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-waited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait did not return after all checks finished")
+		}
+	}
+	finished.Wait()
+	if len(p.sessions) != 0 {
+		t.Errorf("%d sessions still tracked after all checks finished", len(p.sessions))
+	}
+}
+
+// プロバイダが応答しなくても上限の時間で打ち切り、リクエストが終わっても続ける
+func TestFactCheckTimeout(t *testing.T) {
+	if limit := (&pendingChecks{}).limit(); limit != 2*time.Minute {
+		t.Errorf("default limit = %s, want 2m", limit)
+	}
+
+	tests := []struct {
+		name          string
+		cancelRequest bool
+	}{
+		{"provider does not respond", false},
+		{"request ends first", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &hangingProvider{Scripted: fakellm.NewScripted(nil), errs: make(chan error, 1)}
+			s := NewService(nil, fakeRegistry(provider), Config{})
+			s.factChecks.timeout = 20 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			session := &models.DebateSession{ID: 1, Topic: "学校の制服は廃止すべきか", FactCheck: true}
+			start := time.Now()
+			s.startFactCheck(ctx, session, &models.DebateMessage{ID: 1, SessionID: 1, Content: "制服は個性を奪います。"})
+			if tt.cancelRequest {
+				cancel()
+			}
+
+			waitChecks(t, &s.factChecks, session.ID)
+			if err := <-provider.errs; !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("fact check ended with %v, want the time limit", err)
+			}
+			if elapsed := time.Since(start); elapsed < s.factChecks.timeout {
+				t.Errorf("fact check ended after %s, before the limit of %s", elapsed, s.factChecks.timeout)
+			}
+			if len(s.factChecks.sessions) != 0 {
+				t.Errorf("%d sessions still tracked after the time limit", len(s.factChecks.sessions))
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package debatesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+)
+
+// フィードバックの弱点の分類（フィードバックのスキーマの選択肢と合わせる）
+var weaknessCategories = []string{"evidence", "rebuttal", "logic", "structure", "clarity", "relevance"}
+
+// 弱点の傾向で返す練習テーマの数
+const maxTrendTopics = 5
+
+// user_vs_llm の終了後に、ユーザー自身の発言だけを振り返るフィードバックを作成して保存
+// ユーザーが発言していない場合はnilを返す
+func (s *Service) createFeedback(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage) (*models.FeedbackReport, error) {
+	var userTurns []models.DebateMessage
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			userTurns = append(userTurns, msg)
+		}
+	}
+	if len(userTurns) == 0 {
+		return nil, nil
+	}
+
+	provider, err := s.providerFor(session, "feedback")
+	if err != nil {
+		return nil, err
+	}
+
+	lang := sessionLanguage(session.Language)
+	data := feedbackPromptData{Topic: session.Topic, Position: session.UserPosition, Turns: len(userTurns)}
+	prompt, err := s.config.Prompts.Render(lang, "feedback", data)
+	if err != nil {
+		return nil, err
+	}
+	data.Transcript = s.transcript(ctx, session, messages, s.config.JudgeContextTokens-llm.EstimateTokens(prompt.System+prompt.User))
+	if prompt, err = s.config.Prompts.Render(lang, "feedback", data); err != nil {
+		return nil, err
+	}
+
+	feedbackMessages := []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, feedbackMessages, s.samplingFor(session, "feedback"), s.schemaFor(session.Language, "feedback_report", openai.FeedbackReportSchema))
+	if err != nil {
+		s.recordUsage(&session.ID, "feedback", llm.UsageOf(err))
+		return nil, err
+	}
+	s.recordUsage(&session.ID, "feedback", response.Usage)
+
+	var report models.FeedbackReport
+	if err := json.Unmarshal([]byte(response.Content), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse feedback response: %w", err)
+	}
+	report.ID = 0
+	report.SessionID = session.ID
+	report.UserID = session.UserID
+	report.PromptVersion = prompt.Version
+
+	// 講評の対象の発言を特定し、分類にない弱点は除く
+	for i := range report.Turns {
+		report.Turns[i].MessageID = 0
+		if turn := report.Turns[i].Turn; turn >= 1 && turn <= len(userTurns) {
+			report.Turns[i].MessageID = userTurns[turn-1].ID
+		}
+	}
+	weaknesses := []string{}
+	for _, w := range report.Weaknesses {
+		if slices.Contains(weaknessCategories, w) && !slices.Contains(weaknesses, w) {
+			weaknesses = append(weaknesses, w)
+		}
+	}
+	report.Weaknesses = weaknesses
+
+	if err := s.database.CreateFeedbackReport(&report); err != nil {
+		return nil, fmt.Errorf("failed to save feedback: %w", err)
+	}
+	return &report, nil
+}
+
+// セッションのフィードバックを取得（フィードバックを受けたユーザー本人のみ）
+func (s *Service) GetFeedbackReport(sessionID, userID int64) (*models.FeedbackReport, error) {
+	report, err := s.database.GetFeedbackReport(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if report.UserID == nil || *report.UserID != userID {
+		return nil, ErrNotParticipant
+	}
+	return report, nil
+}
+
+// ユーザーのフィードバックを通して、繰り返し指摘される弱点と最近勧められた練習テーマを集計
+func (s *Service) GetFeedbackTrends(userID int64) (*models.FeedbackTrends, error) {
+	reports, err := s.database.GetUserFeedbackReports(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trends := &models.FeedbackTrends{
+		Reports:        len(reports),
+		Weaknesses:     []models.WeaknessTrend{},
+		PracticeTopics: []string{},
+	}
+	byCategory := map[string]*models.WeaknessTrend{}
+	for _, r := range reports {
+		for _, w := range r.Weaknesses {
+			t, ok := byCategory[w]
+			if !ok {
+				// 新しい順に取得しているため、最初に見つかった日時が最後に指摘された日時
+				t = &models.WeaknessTrend{Category: w, LastSeen: r.CreatedAt}
+				byCategory[w] = t
+			}
+			t.Count++
+		}
+		for _, topic := range r.PracticeTopics {
+			if len(trends.PracticeTopics) < maxTrendTopics && !slices.Contains(trends.PracticeTopics, topic) {
+				trends.PracticeTopics = append(trends.PracticeTopics, topic)
+			}
+		}
+	}
+
+	for _, t := range byCategory {
+		t.Rate = float64(t.Count) / float64(len(reports))
+		trends.Weaknesses = append(trends.Weaknesses, *t)
+	}
+	sort.Slice(trends.Weaknesses, func(i, j int) bool {
+		a, b := trends.Weaknesses[i], trends.Weaknesses[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Category < b.Category
+	})
+	return trends, nil
+}
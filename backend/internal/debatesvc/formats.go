@@ -0,0 +1,277 @@
+package debatesvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 形式を指定しない場合の自由な応酬（フェーズなし）
+const freeFormat = "free"
+
+// 組み込みのディベート形式
+func DefaultFormats() map[string]models.DebateFormat {
+	return map[string]models.DebateFormat{
+		freeFormat: {Name: freeFormat},
+		"standard": {
+			Name: "standard",
+			Phases: []models.DebatePhase{
+				{Name: "opening", Speakers: []string{"pro", "con"}, MaxChars: 600},
+				{Name: "rebuttal", Speakers: []string{"con", "pro"}, MaxChars: 500},
+				{Name: "cross_examination", Speakers: []string{"pro", "con", "pro", "con"}, MaxChars: 300},
+				{Name: "closing", Speakers: []string{"con", "pro"}, MaxChars: 400},
+			},
+		},
+		"quick": {
+			Name: "quick",
+			Phases: []models.DebatePhase{
+				{Name: "opening", Speakers: []string{"pro", "con"}, MaxChars: 400},
+				{Name: "closing", Speakers: []string{"con", "pro"}, MaxChars: 300},
+			},
+		},
+	}
+}
+
+// JSONファイル（DebateFormatの配列）からディベート形式を読み込む
+func LoadFormats(path string) ([]models.DebateFormat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var formats []models.DebateFormat
+	if err := json.Unmarshal(data, &formats); err != nil {
+		return nil, fmt.Errorf("failed to parse formats: %w", err)
+	}
+	for _, f := range formats {
+		if err := validateFormat(f); err != nil {
+			return nil, err
+		}
+	}
+	return formats, nil
+}
+
+func validateFormat(f models.DebateFormat) error {
+	if f.Name == "" {
+		return fmt.Errorf("format name is empty")
+	}
+	for i, phase := range f.Phases {
+		if phase.Name == "" {
+			return fmt.Errorf("format %s: phase %d has no name", f.Name, i)
+		}
+		if len(phase.Speakers) == 0 {
+			return fmt.Errorf("format %s: phase %s has no speakers", f.Name, phase.Name)
+		}
+		for _, side := range phase.Speakers {
+			if side != "pro" && side != "con" {
+				return fmt.Errorf("format %s: phase %s has invalid speaker %q", f.Name, phase.Name, side)
+			}
+		}
+		if phase.MaxChars < 0 {
+			return fmt.Errorf("format %s: phase %s has negative max_chars", f.Name, phase.Name)
+		}
+	}
+	return nil
+}
+
+// 利用できるディベート形式の一覧
+func (s *Service) ListFormats() []models.DebateFormat {
+	formats := make([]models.DebateFormat, 0, len(s.config.Formats))
+	for _, f := range s.config.Formats {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].Name < formats[j].Name })
+	return formats
+}
+
+// セッションのディベート形式（設定から削除された形式は自由な応酬として扱う）
+func (s *Service) formatOf(session *models.DebateSession) models.DebateFormat {
+	name := session.Format
+	if name == "" {
+		name = freeFormat
+	}
+	f, ok := s.config.Formats[name]
+	if !ok {
+		log.Printf("Unknown debate format %q for session %d, treating as free", name, session.ID)
+		return models.DebateFormat{Name: freeFormat}
+	}
+	return f
+}
+
+// 形式の発言順でturnIndex番目の発言のフェーズと発言する側（全フェーズ終了後はnil）
+func turnAt(format models.DebateFormat, turnIndex int) (*models.DebatePhase, string) {
+	for i := range format.Phases {
+		phase := &format.Phases[i]
+		if turnIndex < len(phase.Speakers) {
+			return phase, phase.Speakers[turnIndex]
+		}
+		turnIndex -= len(phase.Speakers)
+	}
+	return nil, ""
+}
+
+// 発言する側に対応するメッセージの役割
+func roleForSide(session *models.DebateSession, side string) string {
+	if session.Mode == "llm_vs_llm" {
+		if side == "pro" {
+			return "llm1"
+		}
+		return "llm2"
+	}
+	if session.Mode == userVsUser {
+		if side == session.UserPosition {
+			return "user1"
+		}
+		return "user2"
+	}
+	if side == session.UserPosition {
+		return "user"
+	}
+	return "llm"
+}
+
+// turnIndex番目の発言をする役割（チーム戦では側の中で交代する参加者の役割）
+func speakerRole(session *models.DebateSession, format models.DebateFormat, turnIndex int, side string) string {
+	if session.Mode == teamMode {
+		if p := teamSpeaker(session, format, turnIndex); p != nil {
+			return p.Role
+		}
+	}
+	return roleForSide(session, side)
+}
+
+// 現在のフェーズでroleが発言できるか確認し、発言するフェーズを返す（フェーズのない形式ではnil）
+// チーム戦と user_vs_user ではフェーズのない形式でも発言順を確認する（user_vs_user は賛成側から交互に発言する）
+func (s *Service) expectTurn(session *models.DebateSession, role string) (*models.DebatePhase, error) {
+	format := s.formatOf(session)
+	if len(format.Phases) == 0 {
+		expected := role
+		switch session.Mode {
+		case teamMode:
+			expected = speakerRole(session, format, session.TurnIndex, "")
+		case userVsUser:
+			side := "pro"
+			if session.TurnIndex%2 == 1 {
+				side = "con"
+			}
+			expected = roleForSide(session, side)
+		}
+		if expected != role {
+			return nil, fmt.Errorf("%w: it is %s's turn", ErrOutOfTurn, expected)
+		}
+		return nil, nil
+	}
+
+	phase, side := turnAt(format, session.TurnIndex)
+	if phase == nil {
+		return nil, fmt.Errorf("%w: all phases of the %s format are completed", ErrOutOfTurn, format.Name)
+	}
+	if expected := speakerRole(session, format, session.TurnIndex, side); expected != role {
+		return nil, fmt.Errorf("%w: it is %s's turn in the %s phase", ErrOutOfTurn, expected, phase.Name)
+	}
+	return phase, nil
+}
+
+// 発言の順番を発言順の番号で管理するか（フェーズのある形式・人間同士の対戦・チーム戦）
+// 管理する場合は、発言の保存やLLMの呼び出しの前にadvanceTurnで番を確保する
+func ordersTurns(session *models.DebateSession, phase *models.DebatePhase) bool {
+	return phase != nil || session.Mode == userVsUser || session.Mode == teamMode
+}
+
+// 発言の番を確保してフェーズを進め、セッションを保存（発言の保存やLLMの呼び出しの前に呼ぶ）
+// 同時に同じ番で発言した場合は一方だけが確保でき、もう一方はErrOutOfTurnになる
+func (s *Service) advanceTurn(session *models.DebateSession) error {
+	return s.moveTurn(session, 1)
+}
+
+// 確保した番で発言できなかった場合に、発言の順番を元に戻す
+func (s *Service) rewindTurn(session *models.DebateSession) {
+	if err := s.moveTurn(session, -1); err != nil {
+		log.Printf("Failed to rewind turn of session %d: %v", session.ID, err)
+	}
+}
+
+func (s *Service) moveTurn(session *models.DebateSession, delta int) error {
+	prev := session.TurnIndex
+	session.TurnIndex += delta
+	session.CurrentPhase = ""
+	if phase, _ := turnAt(s.formatOf(session), session.TurnIndex); phase != nil {
+		session.CurrentPhase = phase.Name
+	}
+
+	updated, err := s.database.UpdateSessionProgress(session, prev)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if !updated {
+		return fmt.Errorf("%w: another message has already taken this turn", ErrOutOfTurn)
+	}
+	return nil
+}
+
+// 現在の進行状況（フェーズのない形式ではチーム戦の次の発言者のみ、チーム戦以外はnil）
+func (s *Service) phaseStatus(session *models.DebateSession) *models.PhaseStatus {
+	format := s.formatOf(session)
+	if len(format.Phases) == 0 {
+		if session.Mode == teamMode {
+			return &models.PhaseStatus{Format: format.Name, NextSpeaker: speakerRole(session, format, session.TurnIndex, "")}
+		}
+		return nil
+	}
+
+	status := &models.PhaseStatus{Format: format.Name}
+	phase, side := turnAt(format, session.TurnIndex)
+	if phase == nil {
+		status.Completed = true
+		return status
+	}
+	status.Phase = phase.Name
+	status.MaxChars = phase.MaxChars
+	status.NextSpeaker = speakerRole(session, format, session.TurnIndex, side)
+	return status
+}
+
+// フェーズの表示名と指示（形式の定義になければセッションの言語のテンプレートから取得）
+func (s *Service) phaseText(session *models.DebateSession, phase *models.DebatePhase) (string, string) {
+	lang := sessionLanguage(session.Language)
+	title, instruction := phase.Title, phase.Instruction
+	if title == "" {
+		title = phase.Name
+		if s.config.Prompts.HasBlock(lang, "phases", phase.Name+"_title") {
+			if t, err := s.config.Prompts.RenderBlock(lang, "phases", phase.Name+"_title", nil); err == nil {
+				title = t
+			}
+		}
+	}
+	if instruction == "" && s.config.Prompts.HasBlock(lang, "phases", phase.Name) {
+		if text, err := s.config.Prompts.RenderBlock(lang, "phases", phase.Name, nil); err == nil {
+			instruction = text
+		}
+	}
+	return title, instruction
+}
+
+// 発言記録に表示するフェーズ名
+func (s *Service) phaseTitle(session *models.DebateSession, name string) string {
+	for _, phase := range s.formatOf(session).Phases {
+		if phase.Name == name {
+			title, _ := s.phaseText(session, &phase)
+			return title
+		}
+	}
+	return name
+}
+
+// 文字数の上限に合わせて切り詰める
+func truncateRunes(text string, maxChars int) string {
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:maxChars-1]) + "…"
+}
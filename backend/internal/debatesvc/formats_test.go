@@ -0,0 +1,164 @@
+package debatesvc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/debatesvc"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 応答を遅らせて、同時に進めたステップが重なるようにするプロバイダ
+type slowProvider struct {
+	*fakellm.Scripted
+}
+
+func (p slowProvider) ChatCompletion(ctx context.Context, messages []llm.Message, sampling llm.Sampling) (*llm.Response, error) {
+	time.Sleep(50 * time.Millisecond)
+	return p.Scripted.ChatCompletion(ctx, messages, sampling)
+}
+
+// 同時にステップを進めても、発言の順番の1つの枠には1人だけが発言する
+func TestConcurrentPhaseSteps(t *testing.T) {
+	ctx := context.Background()
+
+	env := debatesvc.NewTestEnv(t, slowProvider{fakellm.NewScripted(nil)})
+	database, service := env.DB, env.Service
+
+	session, _, err := service.CreateDebateSession(ctx, &env.User.ID, &models.CreateDebateRequest{
+		Mode:   "llm_vs_llm",
+		Topic:  "学校の制服は廃止すべきか",
+		Format: "quick",
+	})
+	if err != nil {
+		t.Fatalf("CreateDebateSession: %v", err)
+	}
+
+	// 作成したユーザー以外は進められない
+	if _, err := service.ProcessLLMDebateStep(ctx, session.ID, env.AddUser(t, "bob")); !errors.Is(err, debatesvc.ErrNotParticipant) {
+		t.Fatalf("step by another user: err = %v, want ErrNotParticipant", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ProcessLLMDebateStep(ctx, session.ID, env.User.ID); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, debatesvc.ErrOutOfTurn) {
+			t.Errorf("step failed: %v", err)
+		}
+	}
+
+	session, err = database.GetDebateSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetDebateSession: %v", err)
+	}
+	messages, err := database.GetSessionMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionMessages: %v", err)
+	}
+	var roles []string
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			roles = append(roles, msg.Role)
+		}
+	}
+	if len(roles) != session.TurnIndex {
+		t.Fatalf("saved %d messages for %d turns: %v", len(roles), session.TurnIndex, roles)
+	}
+
+	// quick形式の発言順は賛成・反対・反対・賛成（同時に生成した発言は保存の順番が入れ替わりうる）
+	want := map[string]int{}
+	for _, role := range []string{"llm1", "llm2", "llm2", "llm1"}[:session.TurnIndex] {
+		want[role]++
+	}
+	got := map[string]int{}
+	for _, role := range roles {
+		got[role]++
+	}
+	for _, role := range []string{"llm1", "llm2"} {
+		if got[role] != want[role] {
+			t.Errorf("%s spoke %d times in %d turns, want %d", role, got[role], session.TurnIndex, want[role])
+		}
+	}
+}
+
+// 人間同士の対戦でも、同時に送信した発言のうち1つだけがその番の発言として保存される
+func TestConcurrentUserMessages(t *testing.T) {
+	ctx := context.Background()
+
+	env := debatesvc.NewTestEnv(t, nil)
+	database, service := env.DB, env.Service
+	bob := env.AddUser(t, "bob")
+
+	session, _, err := service.CreateDebateSession(ctx, &env.User.ID, &models.CreateDebateRequest{
+		Mode:         "user_vs_user",
+		Topic:        "学校の制服は廃止すべきか",
+		UserPosition: "pro",
+	})
+	if err != nil {
+		t.Fatalf("CreateDebateSession: %v", err)
+	}
+	if _, err := service.JoinDebate(ctx, bob, session.InviteCode, ""); err != nil {
+		t.Fatalf("JoinDebate: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ProcessUserMessage(ctx, session.ID, env.User.ID, "制服は個性を奪います。"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, debatesvc.ErrOutOfTurn) {
+			t.Errorf("send failed: %v", err)
+		}
+	}
+
+	session, err = database.GetDebateSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetDebateSession: %v", err)
+	}
+	messages, err := database.GetSessionMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionMessages: %v", err)
+	}
+	var roles []string
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			roles = append(roles, msg.Role)
+		}
+	}
+	if len(roles) != 1 || session.TurnIndex != 1 {
+		t.Fatalf("saved %v in %d turns, want a single message from user1", roles, session.TurnIndex)
+	}
+
+	// 次はbobの番
+	if _, err := service.ProcessUserMessage(ctx, session.ID, env.User.ID, "費用の負担も大きいです。"); !errors.Is(err, debatesvc.ErrOutOfTurn) {
+		t.Errorf("alice sends twice: err = %v, want ErrOutOfTurn", err)
+	}
+	if _, err := service.ProcessUserMessage(ctx, session.ID, bob, "制服は経済的です。"); err != nil {
+		t.Errorf("bob's reply: %v", err)
+	}
+}
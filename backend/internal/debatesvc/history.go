@@ -0,0 +1,217 @@
+package debatesvc
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// トークン予算に収まるよう、古い発言を要約に置き換えた議論の履歴
+type history struct {
+	summary string                 // 古い発言の要約（要約していない場合は空）
+	recent  []models.DebateMessage // そのまま渡す最新の発言
+}
+
+// 議論の発言か（テーマや司会の発言などはfalse）
+func isTurn(msg models.DebateMessage) bool {
+	return msg.Role != "system"
+}
+
+// 議論の発言だけを取り出す
+func dialogue(messages []models.DebateMessage) []models.DebateMessage {
+	var turns []models.DebateMessage
+	for _, msg := range messages {
+		if isTurn(msg) {
+			turns = append(turns, msg)
+		}
+	}
+	return turns
+}
+
+func turnsTokens(turns []models.DebateMessage) int {
+	total := 0
+	for _, msg := range turns {
+		total += llm.EstimateTokens(msg.Content)
+	}
+	return total
+}
+
+// budgetトークンに収まるように議論の履歴を組み立てる
+// 全発言が収まらない場合は最新のKeepRecentTurns件を残して古い発言を要約し、要約はセッションごとにキャッシュする
+// 要約は予算を超えたときにまとめて更新するため、毎ターン要約し直すことはない
+func (s *Service) compactHistory(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, budget int) history {
+	turns := dialogue(messages)
+	// 全発言が予算に収まる場合は、要約がキャッシュされていてもそのまま渡す
+	// （討論者用の小さい予算で作った要約を、予算の大きい審査で使わないため）
+	if turnsTokens(turns) <= budget {
+		return history{recent: turns}
+	}
+
+	cached, err := s.database.GetSessionSummary(session.ID)
+	if err != nil {
+		log.Printf("Failed to get session summary: %v", err)
+		cached = nil
+	}
+	if cached == nil {
+		cached = &models.SessionSummary{SessionID: session.ID}
+	}
+
+	// キャッシュ済みの要約と、それ以降の発言で予算に収まるか
+	current := history{summary: cached.Content, recent: turnsAfter(turns, cached.ThroughMessageID)}
+	if llm.EstimateTokens(current.summary)+turnsTokens(current.recent) <= budget {
+		return current
+	}
+
+	split := len(turns) - s.config.KeepRecentTurns
+	if split <= 0 {
+		return current
+	}
+	unsummarized := turnsAfter(turns[:split], cached.ThroughMessageID)
+	if len(unsummarized) == 0 {
+		return current
+	}
+
+	summary, err := s.summarize(ctx, session, cached.Content, unsummarized)
+	if err != nil {
+		// 要約に失敗した場合は、要約の後の発言をそのまま渡し、予算を超える分だけ古い方から切り捨てる
+		// （最新のKeepRecentTurns件は切り捨てない）
+		log.Printf("Failed to summarize debate history: %v", err)
+		recent := current.recent
+		for len(recent) > len(turns)-split && llm.EstimateTokens(cached.Content)+turnsTokens(recent) > budget {
+			recent = recent[1:]
+		}
+		if dropped := len(current.recent) - len(recent); dropped > 0 {
+			log.Printf("Dropped %d unsummarized turns of session %d from the debate history to fit %d tokens", dropped, session.ID, budget)
+		}
+		return history{summary: cached.Content, recent: recent}
+	}
+
+	cached.Content = summary
+	cached.ThroughMessageID = unsummarized[len(unsummarized)-1].ID
+	if err := s.database.SaveSessionSummary(cached); err != nil {
+		log.Printf("Failed to save session summary: %v", err)
+	}
+
+	return history{summary: summary, recent: turns[split:]}
+}
+
+// 指定したIDより後の発言
+func turnsAfter(turns []models.DebateMessage, id int64) []models.DebateMessage {
+	for i, msg := range turns {
+		if msg.ID > id {
+			return turns[i:]
+		}
+	}
+	return nil
+}
+
+// これまでの要約に新しい発言を加えた要約を生成
+func (s *Service) summarize(ctx context.Context, session *models.DebateSession, previous string, turns []models.DebateMessage) (string, error) {
+	provider, err := s.providerFor(session, "summary")
+	if err != nil {
+		return "", err
+	}
+
+	prompt, err := s.config.Prompts.Render(sessionLanguage(session.Language), "summary", summaryPromptData{
+		Topic:      session.Topic,
+		Previous:   previous,
+		Transcript: s.formatTranscript(session, turns),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := provider.ChatCompletion(ctx, []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}, s.samplingFor(session, "summary"))
+	if err != nil {
+		return "", err
+	}
+	s.recordUsage(&session.ID, "summary", response.Usage)
+
+	return response.Content, nil
+}
+
+// 審査・司会用に、予算内に収まる議論の記録を作成
+// 要約を使う場合は、要約であることと対象範囲を明記して最新の発言と区別する
+func (s *Service) transcript(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, budget int) string {
+	h := s.compactHistory(ctx, session, messages, budget)
+	if h.summary == "" {
+		return s.formatTranscript(session, h.recent)
+	}
+
+	return textFor(sessionLanguage(session.Language)).Summarized +
+		h.summary + "\n\n" + s.formatTranscript(session, h.recent)
+}
+
+// 立場の表示と発言順を入れ替えた議論の記録（審査員の位置バイアスの確認用）
+// 賛成側の発言を反対側として、相手より先に発言したものとして並べる
+func (s *Service) swappedTranscript(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, budget int) string {
+	h := s.compactHistory(ctx, session, messages, budget)
+
+	// 組にする発言が要約との境目で分かれても順序がずれないよう、議論全体で入れ替えてから要約していない発言を取り出す
+	swapped, turns := swapSides(session, messages)
+	kept := make(map[int64]bool, len(h.recent))
+	for _, msg := range h.recent {
+		kept[msg.ID] = true
+	}
+	var recent []models.DebateMessage
+	for _, msg := range turns {
+		if kept[msg.ID] {
+			recent = append(recent, msg)
+		}
+	}
+	if h.summary == "" {
+		return s.formatTranscript(swapped, recent)
+	}
+
+	text := textFor(sessionLanguage(session.Language))
+	summary := strings.NewReplacer(text.ProSide, text.ConSide, text.ConSide, text.ProSide).Replace(h.summary)
+	return text.Summarized + summary + "\n\n" + s.formatTranscript(swapped, recent)
+}
+
+// 立場を入れ替えたセッションと、議論の発言の順序と役割を入れ替えたもの
+// 発言は議論全体での位置（1番目と2番目、3番目と4番目…）で組にして入れ替える
+// 最後の発言に相手の応答がない場合は、入れ替える相手がいないため最後のまま残す
+func swapSides(session *models.DebateSession, messages []models.DebateMessage) (*models.DebateSession, []models.DebateMessage) {
+	swapped := *session
+	swapped.UserPosition = opposite(session.UserPosition)
+	swapped.LLMPosition = opposite(session.LLMPosition)
+	swapped.User2Position = opposite(session.User2Position)
+	swapped.Participants = make([]models.Participant, len(session.Participants))
+	for i, p := range session.Participants {
+		p.Side = opposite(p.Side)
+		swapped.Participants[i] = p
+	}
+
+	turns := dialogue(messages)
+	reordered := make([]models.DebateMessage, len(turns))
+	for i, msg := range turns {
+		switch msg.Role {
+		case "llm1":
+			msg.Role = "llm2"
+		case "llm2":
+			msg.Role = "llm1"
+		}
+		reordered[i] = msg
+	}
+	for i := 0; i+1 < len(reordered); i += 2 {
+		reordered[i], reordered[i+1] = reordered[i+1], reordered[i]
+	}
+	return &swapped, reordered
+}
+
+func opposite(position string) string {
+	switch position {
+	case "pro":
+		return "con"
+	case "con":
+		return "pro"
+	default:
+		return position
+	}
+}
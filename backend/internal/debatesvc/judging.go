@@ -0,0 +1,299 @@
+package debatesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+)
+
+// 審査員パネルの判定の集計方法
+const (
+	aggregateMajority = "majority" // 勝者の多数決（同数の場合は引き分け）
+	aggregateAverage  = "average"  // 平均点の高い側
+)
+
+// 審査員パネルの人数の上限
+const maxJudgePanel = 7
+
+// セッション作成時に審査員パネルを決定（指定がなければサーバーの既定値、どちらも空ならnil）
+func (s *Service) resolveJudgePanel(language string, panel []models.JudgeSpec) ([]models.JudgeSpec, error) {
+	if len(panel) == 0 {
+		panel = s.config.JudgePanel
+	}
+	if len(panel) == 0 {
+		return nil, nil
+	}
+	if len(panel) > maxJudgePanel {
+		return nil, fmt.Errorf("judge panel allows at most %d judges", maxJudgePanel)
+	}
+
+	resolved := make([]models.JudgeSpec, 0, len(panel))
+	for i, spec := range panel {
+		provider, model, err := s.providers.Resolve(spec.Provider, spec.Model)
+		if err != nil {
+			return nil, fmt.Errorf("judge %d: %v", i+1, err)
+		}
+		if spec.Persona != "" && !s.config.Prompts.HasBlock(language, "judge_personas", spec.Persona) {
+			return nil, fmt.Errorf("judge %d: unknown persona %q", i+1, spec.Persona)
+		}
+		resolved = append(resolved, models.JudgeSpec{Provider: provider, Model: model, Persona: spec.Persona})
+	}
+	return resolved, nil
+}
+
+func validateAggregation(aggregation string) error {
+	switch aggregation {
+	case "", aggregateMajority, aggregateAverage:
+		return nil
+	default:
+		return fmt.Errorf("unknown judge aggregation %q", aggregation)
+	}
+}
+
+// セッションの審査員パネル（パネルがなければセッションの審査員1人）
+func judgePanel(session *models.DebateSession) []models.JudgeSpec {
+	if len(session.JudgePanel) > 0 {
+		return session.JudgePanel
+	}
+	return []models.JudgeSpec{{Provider: session.JudgeProvider, Model: session.JudgeModel}}
+}
+
+// 審査員パネルの全員に並行して審査させ、審査員ごとの判定を返す
+// 位置バイアスを確認するセッションでは、立場と発言順を入れ替えた記録でも全員に審査させる
+// 一部の審査員が失敗しても残りの判定で続け、入れ替えていない審査が全員失敗した場合のみエラーを返す
+func (s *Service) castBallots(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage) ([]models.JudgeBallot, error) {
+	panel := judgePanel(session)
+
+	// 議論の記録は全員で共有する（要約のキャッシュを並行して更新しないよう先に作成）
+	variants := []bool{false}
+	if session.BiasCheck {
+		variants = append(variants, true)
+	}
+	transcripts := make(map[bool]string, len(variants))
+	var ballots []models.JudgeBallot
+	for _, swapped := range variants {
+		transcript, err := s.judgeTranscript(ctx, session, messages, panel, swapped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build judge prompt: %w", err)
+		}
+		transcripts[swapped] = transcript
+		for _, spec := range panel {
+			ballots = append(ballots, models.JudgeBallot{Judge: spec, Swapped: swapped})
+		}
+	}
+
+	usages := make([]llm.Usage, len(ballots))
+	errs := make([]error, len(ballots))
+	var wg sync.WaitGroup
+	for i := range ballots {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := &ballots[i]
+			b.Result, b.PromptVersion, usages[i], errs[i] = s.askJudge(ctx, session, transcripts[b.Swapped], b.Judge)
+			if b.Result != nil && b.Swapped {
+				b.Result = swapResult(b.Result)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var firstErr error
+	succeeded := 0
+	for i, b := range ballots {
+		s.recordUsage(&session.ID, "judge", usages[i])
+		if errs[i] != nil {
+			log.Printf("Judge %d (%s/%s) failed for session %d: %v", i%len(panel)+1, b.Judge.Provider, b.Judge.Model, session.ID, errs[i])
+			ballots[i].Error = errs[i].Error()
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		if !b.Swapped {
+			succeeded++
+		}
+	}
+	if succeeded == 0 {
+		return ballots, fmt.Errorf("failed to get judge response: %w", firstErr)
+	}
+	return ballots, nil
+}
+
+// 立場を入れ替えて審査した判定を元の立場に戻す
+func swapResult(r *models.JudgeResponse) *models.JudgeResponse {
+	return &models.JudgeResponse{
+		Winner:        opposite(r.Winner),
+		Score:         models.Score{Pro: r.Score.Con, Con: r.Score.Pro},
+		Reasoning:     r.Reasoning,
+		ProStrengths:  r.ConStrengths,
+		ProWeaknesses: r.ConWeaknesses,
+		ConStrengths:  r.ProStrengths,
+		ConWeaknesses: r.ProWeaknesses,
+		FinalComment:  r.FinalComment,
+	}
+}
+
+// 入れ替えていない判定を集計し、位置バイアスを確認した場合は入れ替えた判定と比べる
+// 判定が食い違った場合は引き分けとし、食い違いの有無を返す（確認しなかった場合はnil）
+func (s *Service) decideVerdict(session *models.DebateSession, ballots []models.JudgeBallot) (*models.JudgeResponse, *bool) {
+	var normal, swapped []models.JudgeBallot
+	for _, b := range ballots {
+		if b.Result == nil {
+			continue
+		}
+		if b.Swapped {
+			swapped = append(swapped, b)
+		} else {
+			normal = append(normal, b)
+		}
+	}
+
+	verdict := s.aggregateBallots(session, normal)
+	if len(swapped) == 0 {
+		if session.BiasCheck {
+			log.Printf("Position bias check skipped for session %d: all swapped judgements failed", session.ID)
+		}
+		return verdict, nil
+	}
+
+	swappedVerdict := s.aggregateBallots(session, swapped)
+	biased := swappedVerdict.Winner != verdict.Winner
+	if biased {
+		original := *verdict
+		original.Reasoning = fmt.Sprintf(textFor(sessionLanguage(session.Language)).PositionBias,
+			verdict.Winner, swappedVerdict.Winner) + verdict.Reasoning
+		original.Winner = "draw"
+		verdict = &original
+	}
+	return verdict, &biased
+}
+
+// 審査員1人に審査させる
+func (s *Service) askJudge(ctx context.Context, session *models.DebateSession, transcript string, spec models.JudgeSpec) (*models.JudgeResponse, string, llm.Usage, error) {
+	provider, err := s.providers.Get(spec.Provider, spec.Model)
+	if err != nil {
+		return nil, "", llm.Usage{}, err
+	}
+
+	judgeMessages, promptVersion, err := s.buildJudgeMessages(session, transcript, spec.Persona)
+	if err != nil {
+		return nil, "", llm.Usage{}, err
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, judgeMessages, s.samplingFor(session, "judge"), s.schemaFor(session.Language, "judge_result", openai.JudgeResultSchema))
+	if err != nil {
+		return nil, promptVersion, llm.UsageOf(err), err
+	}
+
+	var result models.JudgeResponse
+	if err := json.Unmarshal([]byte(response.Content), &result); err != nil {
+		return nil, promptVersion, response.Usage, fmt.Errorf("failed to parse judge response: %w", err)
+	}
+	return &result, promptVersion, response.Usage, nil
+}
+
+// 審査員ごとの判定を集計して最終的な判定を作る
+// 理由や強み・弱みは、最終的な勝者と同じ判定をした最初の審査員のものを使う
+func (s *Service) aggregateBallots(session *models.DebateSession, ballots []models.JudgeBallot) *models.JudgeResponse {
+	var results []*models.JudgeResponse
+	for _, b := range ballots {
+		if b.Result != nil {
+			results = append(results, b.Result)
+		}
+	}
+	if len(results) == 1 {
+		return results[0]
+	}
+
+	votes := map[string]int{}
+	var proTotal, conTotal float64
+	for _, r := range results {
+		votes[r.Winner]++
+		proTotal += float64(r.Score.Pro)
+		conTotal += float64(r.Score.Con)
+	}
+	proAverage := proTotal / float64(len(results))
+	conAverage := conTotal / float64(len(results))
+
+	winner := "draw"
+	aggregation := session.JudgeAggregation
+	if aggregation == "" {
+		aggregation = s.config.JudgeAggregation
+	}
+	switch aggregation {
+	case aggregateAverage:
+		if proAverage > conAverage {
+			winner = "pro"
+		} else if conAverage > proAverage {
+			winner = "con"
+		}
+	default:
+		if votes["pro"] > votes["con"] && votes["pro"] > votes["draw"] {
+			winner = "pro"
+		} else if votes["con"] > votes["pro"] && votes["con"] > votes["draw"] {
+			winner = "con"
+		}
+	}
+
+	representative := results[0]
+	for _, r := range results {
+		if r.Winner == winner {
+			representative = r
+			break
+		}
+	}
+
+	verdict := *representative
+	verdict.Winner = winner
+	verdict.Score = models.Score{Pro: int(math.Round(proAverage)), Con: int(math.Round(conAverage))}
+	verdict.Reasoning = fmt.Sprintf(textFor(sessionLanguage(session.Language)).PanelVotes,
+		len(results), votes["pro"], votes["con"], votes["draw"]) + representative.Reasoning
+	return &verdict
+}
+
+// 審査員の観点の説明文（観点の指定がなければ空）
+func (s *Service) judgePersona(session *models.DebateSession, persona string) (string, error) {
+	if persona == "" {
+		return "", nil
+	}
+	return s.config.Prompts.RenderBlock(sessionLanguage(session.Language), "judge_personas", persona, nil)
+}
+
+// 保存する審査結果（集計した判定と、審査員ごとの判定）
+// 審査員が1人の場合は、集計した判定にもその審査員のモデルを記録する
+// 集計した判定にはヒントの使用回数も残し、ヒントを使った勝利を審査結果から区別できるようにする
+func judgeResults(session *models.DebateSession, verdict *models.JudgeResponse, ballots []models.JudgeBallot) []models.JudgeResult {
+	results := []models.JudgeResult{{SessionID: session.ID, Kind: "verdict", HintsUsed: session.HintsUsed, JudgeResponse: *verdict}}
+	for _, ballot := range ballots {
+		if ballot.Result == nil {
+			continue
+		}
+		if results[0].PromptVersion == "" {
+			results[0].PromptVersion = ballot.PromptVersion
+		}
+		results = append(results, models.JudgeResult{
+			SessionID:     session.ID,
+			Kind:          "ballot",
+			JudgeProvider: ballot.Judge.Provider,
+			JudgeModel:    ballot.Judge.Model,
+			Persona:       ballot.Judge.Persona,
+			PromptVersion: ballot.PromptVersion,
+			Swapped:       ballot.Swapped,
+			JudgeResponse: *ballot.Result,
+		})
+	}
+	if len(judgePanel(session)) == 1 {
+		results[0].JudgeProvider = ballots[0].Judge.Provider
+		results[0].JudgeModel = ballots[0].Judge.Model
+		results[0].Persona = ballots[0].Judge.Persona
+	}
+	return results
+}
@@ -0,0 +1,136 @@
+package debatesvc
+
+import "fmt"
+
+// 言語が指定されていない場合に使う言語
+const defaultLanguage = "ja"
+
+// プロンプト以外でディベートの記録に使う言語ごとの文言
+// プロンプト本体は言語ごとのテンプレートに置き、実行時に翻訳はしない
+type localeText struct {
+	TopicLine       string // テーマ（%s）
+	TopicDetail     string // 賛成側の立場・反対側の立場・背景（%s×3）
+	Transcript      string // 発言記録の見出し
+	Summarized      string // 要約に置き換えた序盤の見出し
+	ModeratorEnd    string // 司会者による終了の前置き
+	MaxRoundsReason string // 最大ラウンド数に達したときの理由（%d）
+	PanelVotes      string // 審査員パネルの票数（人数・賛成・反対・引き分け %d×4）
+	PositionBias    string // 立場を入れ替えた再審査で判定が食い違ったときの注記（元の判定・入れ替え後の判定 %s×2）
+	FactChecks      string // 審査員に渡すファクトチェックの結果の見出し
+	TimeLimitReason string // ディベート全体の持ち時間を過ぎたときの終了理由（持ち時間 %s）
+	AbandonedReason string // ユーザーが発言しないまま放置したときの終了理由（回数 %d）
+	NoVerdict       string // 時間切れで終了したセッションの審査に失敗したときの注記（終了理由に続ける）
+	TeamRoster      string // 審査員に渡すチームの構成の見出し
+
+	// ファクトチェックの評価の表示名
+	Plausible    string
+	Dubious      string
+	Unverifiable string
+
+	// 立場の表示名（位置バイアスの確認で要約中の表記を入れ替える）
+	ProSide string
+	ConSide string
+
+	// 発言者の表示名
+	ProUser string
+	ConUser string
+	ProAI   string
+	ConAI   string
+	ProAI1  string
+	ConAI2  string
+
+	// チーム戦の発言者の表示名（立場・発言順・種類 %s・%d・%s）と種類の表示名
+	TeamSpeaker string
+	HumanKind   string
+	AIKind      string
+}
+
+var locales = map[string]localeText{
+	"ja": {
+		TopicLine:       "ディベートテーマ: %s\n",
+		TopicDetail:     "賛成側の立場: %s\n反対側の立場: %s\n背景: %s",
+		Transcript:      "【ディベートの内容】\n\n",
+		Summarized:      "【序盤の議論の要約】\n（発言が長いため、序盤の発言は記録係による中立な要約に置き換えています）\n",
+		ModeratorEnd:    "【司会】ディベートを終了します。",
+		MaxRoundsReason: "最大ラウンド数（%d往復）に達しました。",
+		PanelVotes:      "【審査員%d人の判定】賛成%d票・反対%d票・引き分け%d票\n\n",
+		PositionBias:    "【位置バイアスの確認】立場と発言順を入れ替えた再審査と判定が食い違ったため、引き分けとしました（元の判定: %s、入れ替え後の判定: %s）\n\n",
+		FactChecks:      "【ファクトチェック】\n（各発言に含まれる事実についての主張を自動で確認した結果です。審査の参考にしてください）\n",
+		TimeLimitReason: "ディベートの持ち時間（%s）を過ぎました。",
+		AbandonedReason: "ユーザーが%d回分の持ち時間を過ぎても発言しませんでした。",
+		NoVerdict:       "審査に失敗したため、勝敗をつけずに終了しました。",
+		TeamRoster:      "【チーム構成】\n（チーム戦のため、各側の発言者全員の発言を合わせてチームとして評価してください）\n",
+		Plausible:       "もっともらしい",
+		Dubious:         "疑わしい",
+		Unverifiable:    "確認できない",
+		ProSide:         "賛成側",
+		ConSide:         "反対側",
+		ProUser:         "賛成側(ユーザー)",
+		ConUser:         "反対側(ユーザー)",
+		ProAI:           "賛成側(AI)",
+		ConAI:           "反対側(AI)",
+		ProAI1:          "賛成側(AI-1)",
+		ConAI2:          "反対側(AI-2)",
+		TeamSpeaker:     "%s%d(%s)",
+		HumanKind:       "ユーザー",
+		AIKind:          "AI",
+	},
+	"en": {
+		TopicLine:       "Debate topic: %s\n",
+		TopicDetail:     "Pro position: %s\nCon position: %s\nBackground: %s",
+		Transcript:      "[Debate transcript]\n\n",
+		Summarized:      "[Summary of the early debate]\n(The debate is long, so the early statements have been replaced with a neutral summary by the note-taker.)\n",
+		ModeratorEnd:    "[Moderator] The debate is now closed. ",
+		MaxRoundsReason: "The maximum of %d rounds has been reached.",
+		PanelVotes:      "[Panel of %d judges] pro %d, con %d, draw %d\n\n",
+		PositionBias:    "[Position bias check] Re-judging with sides and speaking order swapped gave a different verdict, so the result is a draw (original: %s, swapped: %s)\n\n",
+		FactChecks:      "[Fact check]\n(Automated checks of the factual claims made in each statement, for reference when judging.)\n",
+		TimeLimitReason: "The debate's time limit of %s has passed.",
+		AbandonedReason: "The user did not speak for %d turns' worth of time.",
+		NoVerdict:       " Judging failed, so the debate ended without a verdict.",
+		TeamRoster:      "[Teams]\n(This is a team debate: evaluate each side as a team, combining the statements of all of its speakers.)\n",
+		Plausible:       "plausible",
+		Dubious:         "dubious",
+		Unverifiable:    "unverifiable",
+		ProSide:         "Pro",
+		ConSide:         "Con",
+		ProUser:         "Pro (user)",
+		ConUser:         "Con (user)",
+		ProAI:           "Pro (AI)",
+		ConAI:           "Con (AI)",
+		ProAI1:          "Pro (AI-1)",
+		ConAI2:          "Con (AI-2)",
+		TeamSpeaker:     "%s %d (%s)",
+		HumanKind:       "user",
+		AIKind:          "AI",
+	},
+}
+
+// セッションの言語（古いセッションなど未設定の場合は既定の言語）
+func sessionLanguage(lang string) string {
+	if lang == "" {
+		return defaultLanguage
+	}
+	return lang
+}
+
+// 言語の文言を取得（未対応の言語は既定の言語）
+func textFor(lang string) localeText {
+	if text, ok := locales[lang]; ok {
+		return text
+	}
+	return locales[defaultLanguage]
+}
+
+// 文言とすべてのプロンプトが揃っている言語か確認
+func (s *Service) validateLanguage(lang string) error {
+	if _, ok := locales[lang]; !ok {
+		return fmt.Errorf("unsupported language %q", lang)
+	}
+	for _, name := range []string{"topic", "debater", "judge", "moderator", "summary", "phases", "judge_personas", "personas", "difficulty", "factcheck", "coach", "feedback", "schema"} {
+		if !s.config.Prompts.Has(lang, name) {
+			return fmt.Errorf("prompt %q is not available in language %q", name, lang)
+		}
+	}
+	return nil
+}
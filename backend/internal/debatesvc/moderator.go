@@ -0,0 +1,96 @@
+package debatesvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+)
+
+// セッションごとに指定できるラウンド数の上限
+const maxRoundsLimit = 20
+
+// セッションのラウンド数の下限と上限（未指定の場合はサーバーの設定値）
+func (s *Service) roundLimits(session *models.DebateSession) (int, int) {
+	minRounds, maxRounds := s.config.MinRounds, s.config.MaxRounds
+	if session.MaxRounds > 0 {
+		maxRounds = session.MaxRounds
+	}
+	if session.MinRounds > 0 {
+		minRounds = session.MinRounds
+	}
+	return min(minRounds, maxRounds), maxRounds
+}
+
+// 1往復ごとにディベートを続けるべきか判断し、終了する場合は理由をシステムメッセージとして保存
+// 続ける場合はnilを返す
+func (s *Service) moderateRound(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, rounds int) (*models.DebateMessage, error) {
+	minRounds, maxRounds := s.roundLimits(session)
+
+	var reason, promptVersion string
+	switch {
+	case rounds >= maxRounds:
+		reason = fmt.Sprintf(textFor(sessionLanguage(session.Language)).MaxRoundsReason, maxRounds)
+	case rounds < minRounds:
+		return nil, nil
+	default:
+		result, version, err := s.askModerator(ctx, session, messages, rounds, maxRounds)
+		if err != nil {
+			// 司会者の判断に失敗しても上限までは議論を続ける
+			log.Printf("Failed to get moderator decision: %v", err)
+			return nil, nil
+		}
+		if result.ShouldContinue {
+			return nil, nil
+		}
+		reason = result.Reason
+		promptVersion = version
+	}
+
+	session.EndReason = reason
+	if err := s.database.SetEndReason(session.ID, reason); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return s.database.CreateGeneratedMessage(session.ID, "system", textFor(sessionLanguage(session.Language)).ModeratorEnd+reason, promptVersion)
+}
+
+// 司会者LLMにディベートを続けるべきか問い合わせ、使用したプロンプトのバージョンとともに返す
+func (s *Service) askModerator(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, rounds, maxRounds int) (*models.DebateContinueResponse, string, error) {
+	provider, err := s.providerFor(session, "moderator")
+	if err != nil {
+		return nil, "", err
+	}
+
+	data := moderatorPromptData{Topic: session.Topic, Rounds: rounds, MaxRounds: maxRounds}
+	prompt, err := s.config.Prompts.Render(sessionLanguage(session.Language), "moderator", data)
+	if err != nil {
+		return nil, "", err
+	}
+	data.Transcript = s.transcript(ctx, session, messages, s.config.JudgeContextTokens-llm.EstimateTokens(prompt.System+prompt.User))
+	if prompt, err = s.config.Prompts.Render(sessionLanguage(session.Language), "moderator", data); err != nil {
+		return nil, "", err
+	}
+
+	moderatorMessages := []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, moderatorMessages, s.samplingFor(session, "moderator"), s.schemaFor(session.Language, "debate_continue", openai.DebateContinueSchema))
+	if err != nil {
+		s.recordUsage(&session.ID, "moderator", llm.UsageOf(err))
+		return nil, "", err
+	}
+	s.recordUsage(&session.ID, "moderator", response.Usage)
+
+	var result models.DebateContinueResponse
+	if err := json.Unmarshal([]byte(response.Content), &result); err != nil {
+		return nil, "", fmt.Errorf("failed to parse moderator response: %w", err)
+	}
+	return &result, prompt.Version, nil
+}
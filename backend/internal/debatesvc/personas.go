@@ -0,0 +1,59 @@
+package debatesvc
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// AI討論者のペルソナ（口調や論じ方はpersonasテンプレートの同名のブロック、表示名は"<名前>_title"のブロック）
+var personaNames = []string{"cross_examiner", "policy_wonk", "socratic", "populist"}
+
+func validatePersona(mode, persona string) error {
+	if persona == "" {
+		return nil
+	}
+	if mode != "user_vs_llm" {
+		return fmt.Errorf("persona is only available in user_vs_llm mode")
+	}
+	if !slices.Contains(personaNames, persona) {
+		return fmt.Errorf("unknown persona %q", persona)
+	}
+	return nil
+}
+
+// ペルソナの一覧と戦績（表示名はlanguageのテンプレートから取得）
+func (s *Service) ListPersonas(language string) ([]models.PersonaInfo, error) {
+	language = sessionLanguage(language)
+	if err := s.validateLanguage(language); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	records, err := s.database.GetPersonaRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	personas := make([]models.PersonaInfo, 0, len(personaNames))
+	for _, name := range personaNames {
+		info := records[name]
+		info.Name = name
+		info.Title = name
+		if s.config.Prompts.HasBlock(language, "personas", name+"_title") {
+			if title, err := s.config.Prompts.RenderBlock(language, "personas", name+"_title", nil); err == nil {
+				info.Title = title
+			}
+		}
+		personas = append(personas, info)
+	}
+	return personas, nil
+}
+
+// セッションのペルソナの口調と論じ方（ペルソナがなければ空）
+func (s *Service) personaPrompt(session *models.DebateSession) (string, error) {
+	if session.Persona == "" {
+		return "", nil
+	}
+	return s.config.Prompts.RenderBlock(sessionLanguage(session.Language), "personas", session.Persona, nil)
+}
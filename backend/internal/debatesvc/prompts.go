@@ -0,0 +1,64 @@
+package debatesvc
+
+// プロンプトテンプレートに渡すデータ（フィールド名はテンプレートから参照される）
+
+type debaterPromptData struct {
+	Topic      string
+	Position   string // "pro" / "con"
+	Structured bool
+	Summary    string
+	Persona    string // ペルソナの口調と論じ方（ペルソナを選んだ場合のみ）
+	Difficulty string // 難易度に応じた指示（user_vs_llm で標準以外の難易度の場合のみ）
+
+	// 回答の目安の長さ（日本語は文字数、英語は語数）
+	ReplyChars int
+	ReplyWords int
+
+	// フェーズのある形式の場合のみ設定
+	Phase            string
+	PhaseTitle       string
+	PhaseInstruction string
+	MaxChars         int
+}
+
+type judgePromptData struct {
+	Topic      string
+	Transcript string
+	Persona    string // 審査の観点（パネルで観点を指定した場合のみ）
+}
+
+type factCheckPromptData struct {
+	Topic     string
+	Statement string
+}
+
+type coachPromptData struct {
+	Topic      string
+	Position   string // ユーザーの立場 "pro" / "con"
+	Transcript string
+}
+
+type feedbackPromptData struct {
+	Topic      string
+	Position   string // ユーザーの立場 "pro" / "con"
+	Turns      int    // ユーザーの発言の数
+	Transcript string
+}
+
+type moderatorPromptData struct {
+	Topic      string
+	Rounds     int
+	MaxRounds  int
+	Transcript string
+}
+
+type schemaPromptData struct {
+	Name   string
+	Schema string // JSONスキーマ（整形済みのJSON）
+}
+
+type summaryPromptData struct {
+	Topic      string
+	Previous   string
+	Transcript string
+}
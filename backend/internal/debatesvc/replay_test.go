@@ -0,0 +1,89 @@
+package debatesvc_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/debatesvc"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 1回分のディベートの結果（記録時と再生時で比較する）
+type debateRun struct {
+	replies []string
+	winner  string
+	comment string
+}
+
+// 偽プロバイダでユーザー vs LLM のディベートを最後まで進める
+func runDebate(t *testing.T, provider llm.Provider) debateRun {
+	t.Helper()
+	ctx := context.Background()
+
+	env := debatesvc.NewTestEnv(t, provider)
+	service, user := env.Service, env.User
+
+	session, _, err := service.CreateDebateSession(ctx, &user.ID, &models.CreateDebateRequest{
+		Mode:         "user_vs_llm",
+		Topic:        "学校の制服は廃止すべきか",
+		UserPosition: "pro",
+	})
+	if err != nil {
+		t.Fatalf("CreateDebateSession: %v", err)
+	}
+
+	var run debateRun
+	for _, content := range []string{"制服は個性を奪います。", "費用の負担も大きいです。"} {
+		resp, err := service.ProcessUserMessage(ctx, session.ID, user.ID, content)
+		if err != nil {
+			t.Fatalf("ProcessUserMessage: %v", err)
+		}
+		if resp.LLMMessage == nil {
+			t.Fatalf("no reply to %q", content)
+		}
+		run.replies = append(run.replies, resp.LLMMessage.Content)
+	}
+
+	end, err := service.EndDebate(ctx, session.ID, user.ID)
+	if err != nil {
+		t.Fatalf("EndDebate: %v", err)
+	}
+	run.winner = end.JudgeResult.Winner
+	run.comment = end.JudgeResult.Reasoning
+	return run
+}
+
+// 記録したカセットを再生すると、LLMなしで同じディベートを再現できる
+func TestReplayCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	cassette, err := fakellm.OpenCassette(path)
+	if err != nil {
+		t.Fatalf("OpenCassette: %v", err)
+	}
+	recorded := runDebate(t, cassette.Wrap(fakellm.NewScripted(nil)))
+	if err := cassette.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	replayer, err := fakellm.NewReplayer(path)
+	if err != nil {
+		t.Fatalf("NewReplayer: %v", err)
+	}
+	replayed := runDebate(t, replayer)
+
+	if len(replayed.replies) != len(recorded.replies) {
+		t.Fatalf("replayed %d replies, recorded %d", len(replayed.replies), len(recorded.replies))
+	}
+	for i := range recorded.replies {
+		if replayed.replies[i] != recorded.replies[i] {
+			t.Errorf("reply %d = %q, want %q", i+1, replayed.replies[i], recorded.replies[i])
+		}
+	}
+	if replayed.winner != recorded.winner || replayed.comment != recorded.comment {
+		t.Errorf("verdict = %q/%q, want %q/%q", replayed.winner, replayed.comment, recorded.winner, recorded.comment)
+	}
+}
@@ -3,77 +3,324 @@ package debatesvc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"time"
+	"unicode/utf8"
 
 	"github.com/levyxx/LLM-debate-battle/backend/internal/db"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
 	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
 	"github.com/levyxx/LLM-debate-battle/backend/internal/openai"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/prompts"
 )
 
+// サービスの設定
+type Config struct {
+	// トークン使用量からコストを計算するための料金表
+	Prices llm.PriceTable
+
+	// LLM vs LLM で司会者が終了を判断し始めるラウンド数と、必ず終了するラウンド数
+	MinRounds int
+	MaxRounds int
+
+	// 議論の履歴に使うトークン数の上限（討論者と審査員・司会者）
+	// 超えた場合は最新のKeepRecentTurns件を残し、古い発言を要約に置き換える
+	ContextTokens      int
+	JudgeContextTokens int
+	KeepRecentTurns    int
+
+	// 役割ごとのサンプリングパラメータの既定値（セッション作成時に上書き可能）
+	DebaterSampling llm.Sampling
+	JudgeSampling   llm.Sampling
+	TopicSampling   llm.Sampling
+
+	// プロンプトテンプレート（nilの場合は組み込みのテンプレート）
+	Prompts *prompts.Store
+
+	// 追加のディベート形式（同名の組み込み形式を上書きする）
+	Formats map[string]models.DebateFormat
+
+	// 審査員パネルの既定値（空の場合は審査員1人）と判定の集計方法（"majority" or "average"）
+	JudgePanel       []models.JudgeSpec
+	JudgeAggregation string
+
+	// 位置バイアスの確認の既定値（セッション作成時に上書き可能）
+	BiasCheck bool
+
+	// 難易度ごとのAI討論者のモデル（指定のない難易度は既定のプロバイダ）
+	DifficultyModels map[string]ModelChoice
+
+	// 発言ごとのファクトチェックの既定値（セッション作成時に上書き可能）と、その結果を審査員に渡すか
+	FactCheck      bool
+	FactCheckJudge bool
+
+	// user_vs_llm で1回のディベートに使えるコーチのヒントの回数の既定値（セッション作成時に上書き可能）
+	HintBudget int
+
+	// user_vs_llm の終了後にユーザーの発言へのフィードバックを作成するか
+	Feedback bool
+
+	// 1回の発言とディベート全体の持ち時間の既定値（0は制限なし、セッション作成時に上書き可能）
+	TurnLimit  time.Duration
+	TotalLimit time.Duration
+	// 時間切れで放置されたセッションの終わらせ方（"judge" or "forfeit"）
+	TimeoutOutcome string
+}
+
+// 審査員のサンプリングパラメータの既定値（判定を再現できるよう低温度・固定シード）
+func DefaultJudgeSampling() llm.Sampling {
+	temperature := 0.2
+	seed := int64(42)
+	return llm.Sampling{Temperature: &temperature, Seed: &seed}
+}
+
+// リクエスト内容が不正であることを示す（APIでは400として扱う）
+var ErrInvalidRequest = errors.New("invalid request")
+
+// フェーズのある形式で発言順に合わない発言であることを示す（APIでは409として扱う）
+var ErrOutOfTurn = errors.New("out of turn")
+
 type Service struct {
-	database *db.DB
-	client   *openai.Client
+	database   *db.DB
+	providers  *llm.Registry
+	config     Config
+	factChecks pendingChecks
 }
 
-func NewService(database *db.DB, client *openai.Client) *Service {
+func NewService(database *db.DB, providers *llm.Registry, config Config) *Service {
+	if config.Prices == nil {
+		config.Prices = llm.DefaultPriceTable()
+	}
+	if config.MaxRounds <= 0 {
+		config.MaxRounds = 5
+	}
+	if config.MinRounds <= 0 || config.MinRounds > config.MaxRounds {
+		config.MinRounds = min(2, config.MaxRounds)
+	}
+	if config.ContextTokens <= 0 {
+		config.ContextTokens = 6000
+	}
+	if config.JudgeContextTokens <= 0 {
+		config.JudgeContextTokens = 24000
+	}
+	if config.KeepRecentTurns <= 0 {
+		config.KeepRecentTurns = 4
+	}
+	config.HintBudget = min(max(config.HintBudget, 0), maxHintBudget)
+	if config.TimeoutOutcome == "" {
+		config.TimeoutOutcome = TimeoutJudge
+	}
+	config.JudgeSampling = DefaultJudgeSampling().Merge(config.JudgeSampling)
+	if config.Prompts == nil {
+		config.Prompts = prompts.NewEmbedded()
+	}
+	formats := DefaultFormats()
+	for name, f := range config.Formats {
+		formats[name] = f
+	}
+	config.Formats = formats
+	if config.JudgeAggregation == "" {
+		config.JudgeAggregation = aggregateMajority
+	}
+
 	return &Service{
-		database: database,
-		client:   client,
+		database:  database,
+		providers: providers,
+		config:    config,
 	}
 }
 
-// ランダムなディベートテーマを生成
-func (s *Service) GenerateRandomTopic(ctx context.Context) (*models.DebateTopicResponse, error) {
-	messages := []openai.Message{
-		{
-			Role: "system",
-			Content: `あなたはディベートのテーマを提案するアシスタントです。
-興味深く、議論の余地があり、両方の立場から論じることができるディベートテーマを提案してください。
-テーマは具体的で、一般の人でも議論に参加できるものにしてください。
-政治、社会、技術、倫理、教育など様々な分野からテーマを選んでください。`,
-		},
-		{
-			Role:    "user",
-			Content: "新しいディベートテーマを1つ提案してください。",
-		},
+// ランダムなディベートテーマを生成（languageが空の場合は既定の言語）
+func (s *Service) GenerateRandomTopic(ctx context.Context, language string) (*models.DebateTopicResponse, error) {
+	language = sessionLanguage(language)
+	if err := s.validateLanguage(language); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
 	}
 
-	response, err := s.client.ChatCompletionWithSchema(ctx, messages, "debate_topic", openai.DebateTopicSchema)
+	topic, _, usage, err := s.generateTopic(ctx, language, s.config.TopicSampling)
+	s.recordUsage(nil, "topic", usage)
 	if err != nil {
 		return nil, err
 	}
+	return topic, nil
+}
+
+// テーマを生成し、プロンプトのバージョンと使用量とともに返す（使用量の記録は呼び出し側で行う）
+func (s *Service) generateTopic(ctx context.Context, language string, sampling llm.Sampling) (*models.DebateTopicResponse, string, llm.Usage, error) {
+	prompt, err := s.config.Prompts.Render(language, "topic", nil)
+	if err != nil {
+		return nil, "", llm.Usage{}, err
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+
+	provider, err := s.providers.Default()
+	if err != nil {
+		return nil, "", llm.Usage{}, err
+	}
+
+	response, err := provider.ChatCompletionWithSchema(ctx, messages, sampling, s.schemaFor(language, "debate_topic", openai.DebateTopicSchema))
+	if err != nil {
+		return nil, "", llm.UsageOf(err), err
+	}
 
 	var topic models.DebateTopicResponse
-	if err := json.Unmarshal([]byte(response), &topic); err != nil {
-		return nil, fmt.Errorf("failed to parse topic response: %w", err)
+	if err := json.Unmarshal([]byte(response.Content), &topic); err != nil {
+		return nil, "", response.Usage, fmt.Errorf("failed to parse topic response: %w", err)
 	}
 
-	return &topic, nil
+	return &topic, prompt.Version, response.Usage, nil
 }
 
 // ディベートセッションを作成
+// LLM vs LLM のセッションはユーザーの履歴に含めないよう、作成したユーザーをCreatedByにのみ記録する
 func (s *Service) CreateDebateSession(ctx context.Context, userID *int64, req *models.CreateDebateRequest) (*models.DebateSession, *models.DebateTopicResponse, error) {
+	newSession := &models.DebateSession{
+		UserID:          userID,
+		CreatedBy:       userID,
+		Mode:            req.Mode,
+		Status:          "active",
+		StructuredTurns: req.StructuredTurns,
+		MinRounds:       req.MinRounds,
+		MaxRounds:       req.MaxRounds,
+		Language:        sessionLanguage(req.Language),
+		Format:          req.Format,
+		Persona:         req.Persona,
+		Difficulty:      req.Difficulty,
+	}
+
+	if err := validateMode(req.Mode); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if req.Mode == "llm_vs_llm" {
+		newSession.UserID = nil
+	}
+
+	if err := s.validateLanguage(newSession.Language); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	if err := validatePersona(req.Mode, req.Persona); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	if err := validateDifficulty(req.Mode, req.Difficulty); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if req.Mode == "user_vs_llm" && newSession.Difficulty == "" {
+		newSession.Difficulty = defaultDifficulty
+	}
+
+	if newSession.Format == "" {
+		newSession.Format = freeFormat
+	}
+	format, ok := s.config.Formats[newSession.Format]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown format %q", ErrInvalidRequest, newSession.Format)
+	}
+	if len(format.Phases) > 0 {
+		newSession.CurrentPhase = format.Phases[0].Name
+	}
+
+	if req.MinRounds < 0 || req.MaxRounds < 0 || req.MaxRounds > maxRoundsLimit ||
+		(req.MinRounds > 0 && req.MaxRounds > 0 && req.MinRounds > req.MaxRounds) {
+		return nil, nil, fmt.Errorf("%w: rounds must satisfy 0 <= min_rounds <= max_rounds <= %d", ErrInvalidRequest, maxRoundsLimit)
+	}
+
+	// 役割ごとのサンプリングパラメータを決定
+	var err error
+	newSession.DebaterSampling, err = mergeSampling(s.config.DebaterSampling, req.DebaterSampling)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: debater_sampling: %v", ErrInvalidRequest, err)
+	}
+	newSession.JudgeSampling, err = mergeSampling(s.config.JudgeSampling, req.JudgeSampling)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: judge_sampling: %v", ErrInvalidRequest, err)
+	}
+	newSession.TopicSampling, err = mergeSampling(s.config.TopicSampling, req.TopicSampling)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: topic_sampling: %v", ErrInvalidRequest, err)
+	}
+
+	// 役割ごとのモデルを決定（テーマ生成の前に検証する）
+	if req.Mode == "llm_vs_llm" {
+		newSession.LLM1Provider, newSession.LLM1Model, err = s.providers.Resolve(req.LLM1Provider, req.LLM1Model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: llm1: %v", ErrInvalidRequest, err)
+		}
+		newSession.LLM2Provider, newSession.LLM2Model, err = s.providers.Resolve(req.LLM2Provider, req.LLM2Model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: llm2: %v", ErrInvalidRequest, err)
+		}
+	} else if choice, ok := s.config.DifficultyModels[newSession.Difficulty]; ok {
+		newSession.LLMProvider, newSession.LLMModel, err = s.providers.Resolve(choice.Provider, choice.Model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: difficulty %s: %v", ErrInvalidRequest, newSession.Difficulty, err)
+		}
+	}
+	newSession.JudgeProvider, newSession.JudgeModel, err = s.providers.Resolve(req.JudgeProvider, req.JudgeModel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: judge: %v", ErrInvalidRequest, err)
+	}
+	newSession.JudgePanel, err = s.resolveJudgePanel(newSession.Language, req.JudgePanel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: judge_panel: %v", ErrInvalidRequest, err)
+	}
+	if err := validateAggregation(req.JudgeAggregation); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	newSession.JudgeAggregation = req.JudgeAggregation
+	newSession.BiasCheck = s.config.BiasCheck
+	if req.BiasCheck != nil {
+		newSession.BiasCheck = *req.BiasCheck
+	}
+	newSession.HintBudget, err = s.resolveHintBudget(req.Mode, req.HintBudget)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if err := s.resolveTimeLimits(newSession, req); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	participants, err := s.resolveParticipants(req.Mode, req.Participants, userID, req.UserPosition)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	newSession.FactCheck = s.config.FactCheck
+	if req.FactCheck != nil {
+		newSession.FactCheck = *req.FactCheck
+	}
+	if newSession.JudgeAggregation == "" && len(newSession.JudgePanel) > 1 {
+		newSession.JudgeAggregation = s.config.JudgeAggregation
+	}
+
 	var topic string
 	var topicInfo *models.DebateTopicResponse
+	var topicUsage *llm.Usage
+	var topicPromptVersion string
 
 	// テーマの決定
 	if req.RandomizeTopic || req.Topic == "" {
-		generatedTopic, err := s.GenerateRandomTopic(ctx)
+		generatedTopic, promptVersion, usage, err := s.generateTopic(ctx, newSession.Language, s.samplingFor(newSession, "topic"))
 		if err != nil {
+			s.recordUsage(nil, "topic", usage)
 			return nil, nil, fmt.Errorf("failed to generate topic: %w", err)
 		}
 		topic = generatedTopic.Topic
 		topicInfo = generatedTopic
+		topicUsage = &usage
+		topicPromptVersion = promptVersion
 	} else {
 		topic = req.Topic
 	}
 
 	// ポジションの決定
 	var userPosition string
-	if req.Mode == "user_vs_llm" {
+	if req.Mode == "user_vs_llm" || req.Mode == userVsUser {
 		userPosition = req.UserPosition
 		if req.RandomizePosition || userPosition == "" || userPosition == "random" {
 			rand.Seed(time.Now().UnixNano())
@@ -85,33 +332,59 @@ func (s *Service) CreateDebateSession(ctx context.Context, userID *int64, req *m
 		}
 	}
 
+	// user_vs_user とチーム戦は人間の参加者が招待コードで揃うまで待ち、持ち時間は揃った時点から計る
+	if req.Mode == userVsUser || (req.Mode == teamMode && !allJoined(participants)) {
+		newSession.Status = "waiting"
+		if req.Mode == userVsUser {
+			newSession.User2Position = opposite(userPosition)
+		}
+		newSession.InviteCode, err = newInviteCode()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create invite code: %w", err)
+		}
+	} else {
+		s.startClocks(newSession)
+	}
+
 	// データベースに保存
-	session, err := s.database.CreateDebateSession(userID, req.Mode, topic, userPosition)
+	newSession.Topic = topic
+	newSession.UserPosition = userPosition
+	session, err := s.database.CreateDebateSession(newSession)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	// LLMポジションをセッションに設定（データベースには保存しないがレスポンスに含める）
-	if req.Mode == "user_vs_llm" {
-		session.UserPosition = userPosition
-		if userPosition == "pro" {
-			session.LLMPosition = "con"
-		} else {
-			session.LLMPosition = "pro"
+	// チーム戦の参加者を保存
+	if len(participants) > 0 {
+		for i := range participants {
+			participants[i].SessionID = session.ID
 		}
-	} else if req.Mode == "llm_vs_llm" {
-		session.LLM1Position = "pro"
-		session.LLM2Position = "con"
+		if err := s.database.CreateParticipants(participants); err != nil {
+			return nil, nil, fmt.Errorf("failed to create participants: %w", err)
+		}
+		if session.Participants, err = s.database.GetParticipants(session.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to get participants: %w", err)
+		}
+	}
+
+	// テーマ生成の使用量をセッションに紐付けて記録
+	if topicUsage != nil {
+		s.recordUsage(&session.ID, "topic", *topicUsage)
 	}
 
+	// LLMポジションをセッションに設定（データベースには保存しないがレスポンスに含める）
+	session.UserPosition = userPosition
+	assignPositions(session)
+
 	// システムメッセージを保存
-	systemContent := fmt.Sprintf("ディベートテーマ: %s\n", topic)
+	text := textFor(session.Language)
+	systemContent := fmt.Sprintf(text.TopicLine, topic)
 	if topicInfo != nil {
-		systemContent += fmt.Sprintf("賛成側の立場: %s\n反対側の立場: %s\n背景: %s",
+		systemContent += fmt.Sprintf(text.TopicDetail,
 			topicInfo.ProPosition, topicInfo.ConPosition, topicInfo.Background)
 	}
 
-	_, err = s.database.CreateMessage(session.ID, "system", systemContent)
+	_, err = s.database.CreateGeneratedMessage(session.ID, "system", systemContent, topicPromptVersion)
 	if err != nil {
 		log.Printf("Failed to save system message: %v", err)
 	}
@@ -119,64 +392,159 @@ func (s *Service) CreateDebateSession(ctx context.Context, userID *int64, req *m
 	return session, topicInfo, nil
 }
 
+// ストリーミング中の応答差分を受け取るコールバック（roleは発言者）
+type DeltaFunc func(role, delta string) error
+
 // ユーザーのメッセージに対してLLMが応答
-func (s *Service) ProcessUserMessage(ctx context.Context, sessionID int64, userContent string) (*models.DebateMessage, *models.DebateMessage, error) {
+func (s *Service) ProcessUserMessage(ctx context.Context, sessionID, userID int64, userContent string) (*models.SendMessageResponse, error) {
+	return s.ProcessUserMessageStream(ctx, sessionID, userID, userContent, nil)
+}
+
+// ユーザーのメッセージに対してLLMが応答（応答の差分をonDeltaへ逐次通知）
+// フェーズのある形式では、ユーザーの番でなければ拒否し、次がLLMの番の場合のみ応答する
+// user_vs_user とチーム戦では送信したユーザーの番か確認して保存するだけで、LLMは応答しない（チーム戦のAIの番はllm-stepで進める）
+func (s *Service) ProcessUserMessageStream(ctx context.Context, sessionID, userID int64, userContent string, onDelta DeltaFunc) (*models.SendMessageResponse, error) {
 	session, err := s.database.GetDebateSession(sessionID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("session not found: %w", err)
+		return nil, fmt.Errorf("session not found: %w", err)
 	}
 
+	if session.Status == "waiting" {
+		return nil, fmt.Errorf("%w: waiting for the opponent to join", ErrOutOfTurn)
+	}
 	if session.Status != "active" && session.Status != "ongoing" {
-		return nil, nil, fmt.Errorf("debate has already ended")
+		return nil, fmt.Errorf("debate has already ended")
+	}
+
+	role, err := participantRole(session, userID)
+	if err != nil {
+		return nil, err
+	}
+	phase, err := s.expectTurn(session, role)
+	if err != nil {
+		return nil, err
+	}
+
+	// 全体の持ち時間を過ぎていれば終了させ、番の持ち時間を過ぎていれば送信した内容を保存せずにパスとして数える
+	// パスの後は次の持ち時間を始め、ユーザーは改めて発言できる
+	now := time.Now()
+	if session.Deadline != nil && now.After(*session.Deadline) {
+		if err := s.expireSession(ctx, session, expiryReason(session, now)); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: the debate has been finished", ErrTimeLimit)
+	}
+	if session.TurnDeadline != nil && now.After(*session.TurnDeadline) {
+		session.Passes++
+		if err := s.restartTurnClock(session); err != nil {
+			return nil, fmt.Errorf("failed to update session: %w", err)
+		}
+		return nil, fmt.Errorf("%w: the time for this turn ran out and the message was not saved", ErrTimeLimit)
+	}
+
+	if phase != nil && phase.MaxChars > 0 && utf8.RuneCountInString(userContent) > phase.MaxChars {
+		return nil, fmt.Errorf("%w: the %s phase allows at most %d characters", ErrInvalidRequest, phase.Name, phase.MaxChars)
+	}
+
+	// 発言の順番がある場合は先に番を確保してから保存
+	ordered := ordersTurns(session, phase)
+	if ordered {
+		if err := s.advanceTurn(session); err != nil {
+			return nil, err
+		}
 	}
 
 	// ユーザーメッセージを保存
-	userMsg, err := s.database.CreateMessage(sessionID, "user", userContent)
+	userMsg, err := s.database.InsertMessage(&models.DebateMessage{
+		SessionID:     sessionID,
+		Role:          role,
+		Content:       userContent,
+		Phase:         phaseName(phase),
+		ParticipantID: participantID(session, role),
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to save user message: %w", err)
+		if ordered {
+			s.rewindTurn(session)
+		}
+		return nil, fmt.Errorf("failed to save user message: %w", err)
+	}
+	s.startFactCheck(ctx, session, userMsg)
+
+	response := &models.SendMessageResponse{UserMessage: userMsg}
+	if session.Mode == userVsUser || session.Mode == teamMode {
+		response.Phase = s.phaseStatus(session)
+		return response, nil
+	}
+	if status := s.phaseStatus(session); status != nil && status.NextSpeaker != "llm" {
+		if err := s.restartTurnClock(session); err != nil {
+			return nil, fmt.Errorf("failed to update session: %w", err)
+		}
+		response.Phase = status
+		return response, nil
 	}
 
 	// 過去のメッセージを取得
 	messages, err := s.database.GetSessionMessages(sessionID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
-	// LLM用のメッセージを構築
-	llmMessages := s.buildLLMMessages(session, messages, "llm")
+	assignPositions(session)
 
-	// LLMの応答を生成
-	response, err := s.client.ChatCompletion(ctx, llmMessages)
+	// LLMの応答を生成して保存
+	response.LLMMessage, err = s.takeTurn(ctx, session, messages, "llm", onDelta)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get LLM response: %w", err)
+		return nil, err
 	}
-
-	// LLMメッセージを保存
-	llmMsg, err := s.database.CreateMessage(sessionID, "llm", response)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to save LLM message: %w", err)
+	if err := s.restartTurnClock(session); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
+	response.Phase = s.phaseStatus(session)
 
-	return userMsg, llmMsg, nil
+	return response, nil
 }
 
 // LLM同士のディベートを1ステップ進める
-func (s *Service) ProcessLLMDebateStep(ctx context.Context, sessionID int64) (*models.DebateMessage, *models.DebateMessage, bool, error) {
+func (s *Service) ProcessLLMDebateStep(ctx context.Context, sessionID, userID int64) (*models.LLMDebateStepResponse, error) {
+	return s.ProcessLLMDebateStepStream(ctx, sessionID, userID, nil)
+}
+
+// LLM同士のディベートを1ステップ進める（応答の差分をonDeltaへ逐次通知）
+// 自由な応酬では1往復ごとに司会者が継続を判断し、終了する場合はIsFinishedを立てる
+// フェーズのある形式では発言順に従って1人ずつ発言し、user_vs_llm でLLMの番の場合にも使う
+// 進められるのは作成したユーザーと参加者のみ（canControl）
+func (s *Service) ProcessLLMDebateStepStream(ctx context.Context, sessionID, userID int64, onDelta DeltaFunc) (*models.LLMDebateStepResponse, error) {
 	session, err := s.database.GetDebateSession(sessionID)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("session not found: %w", err)
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if err := canControl(session, userID); err != nil {
+		return nil, err
 	}
 
+	if session.Status == "waiting" {
+		return nil, fmt.Errorf("%w: waiting for the opponent to join", ErrOutOfTurn)
+	}
 	if session.Status != "active" && session.Status != "ongoing" {
-		return nil, nil, true, nil
+		return &models.LLMDebateStepResponse{IsFinished: true}, nil
 	}
 
 	messages, err := s.database.GetSessionMessages(sessionID)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to get messages: %w", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
-	// 議論の回数をチェック（最大5往復）
+	assignPositions(session)
+
+	if status := s.phaseStatus(session); status != nil {
+		return s.processPhaseStep(ctx, session, messages, status, onDelta)
+	}
+
+	if session.Mode != "llm_vs_llm" {
+		return nil, fmt.Errorf("%w: llm step is only available in llm_vs_llm mode or formats with phases", ErrInvalidRequest)
+	}
+
+	// 議論の回数をチェック
 	llm1Count := 0
 	llm2Count := 0
 	for _, msg := range messages {
@@ -187,94 +555,209 @@ func (s *Service) ProcessLLMDebateStep(ctx context.Context, sessionID int64) (*m
 		}
 	}
 
-	if llm1Count >= 5 && llm2Count >= 5 {
-		return nil, nil, true, nil
+	_, maxRounds := s.roundLimits(session)
+	if session.EndReason != "" || (llm1Count >= maxRounds && llm2Count >= maxRounds) {
+		return &models.LLMDebateStepResponse{IsFinished: true}, nil
 	}
 
-	// LLM vs LLMの場合のポジション設定
-	session.LLM1Position = "pro"
-	session.LLM2Position = "con"
-
 	// 1回の呼び出しで1つのLLMの応答のみを返す
 	// LLM1の番（LLM1のカウントがLLM2以下の場合）
 	if llm1Count <= llm2Count {
-		llm1Messages := s.buildLLMMessages(session, messages, "llm1")
-		response, err := s.client.ChatCompletion(ctx, llm1Messages)
+		llm1Msg, err := s.takeTurn(ctx, session, messages, "llm1", onDelta)
 		if err != nil {
-			return nil, nil, false, fmt.Errorf("failed to get LLM1 response: %w", err)
+			return nil, err
 		}
+		return &models.LLMDebateStepResponse{LLM1Message: llm1Msg}, nil
+	}
 
-		llm1Msg, err := s.database.CreateMessage(sessionID, "llm1", response)
-		if err != nil {
-			return nil, nil, false, fmt.Errorf("failed to save LLM1 message: %w", err)
-		}
+	// LLM2の番
+	llm2Msg, err := s.takeTurn(ctx, session, messages, "llm2", onDelta)
+	if err != nil {
+		return nil, err
+	}
 
-		// 終了判定（次のステップで終わるかどうか）
-		isFinished := llm1Count >= 4 && llm2Count >= 5
+	// 1往復が終わったので司会者が継続を判断
+	moderatorMsg, err := s.moderateRound(ctx, session, append(messages, *llm2Msg), llm2Count+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate debate: %w", err)
+	}
+
+	return &models.LLMDebateStepResponse{
+		LLM2Message:      llm2Msg,
+		ModeratorMessage: moderatorMsg,
+		IsFinished:       moderatorMsg != nil,
+	}, nil
+}
 
-		return llm1Msg, nil, isFinished, nil
+// フェーズのある形式とチーム戦で、発言順がLLMの番であれば1つ発言させる
+func (s *Service) processPhaseStep(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, status *models.PhaseStatus, onDelta DeltaFunc) (*models.LLMDebateStepResponse, error) {
+	if status.Completed {
+		return &models.LLMDebateStepResponse{Phase: status, IsFinished: true}, nil
+	}
+	if isHumanRole(session, status.NextSpeaker) {
+		if status.Phase == "" {
+			return nil, fmt.Errorf("%w: it is %s's turn", ErrOutOfTurn, status.NextSpeaker)
+		}
+		return nil, fmt.Errorf("%w: it is %s's turn in the %s phase", ErrOutOfTurn, status.NextSpeaker, status.Phase)
 	}
 
-	// LLM2の番
-	llm2Messages := s.buildLLMMessages(session, messages, "llm2")
-	response, err := s.client.ChatCompletion(ctx, llm2Messages)
+	msg, err := s.takeTurn(ctx, session, messages, status.NextSpeaker, onDelta)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to get LLM2 response: %w", err)
+		return nil, err
+	}
+	if err := s.restartTurnClock(session); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
 
-	llm2Msg, err := s.database.CreateMessage(sessionID, "llm2", response)
-	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to save LLM2 message: %w", err)
+	response := &models.LLMDebateStepResponse{Phase: s.phaseStatus(session)}
+	switch status.NextSpeaker {
+	case "llm1":
+		response.LLM1Message = msg
+	case "llm2":
+		response.LLM2Message = msg
+	default:
+		response.LLMMessage = msg
 	}
+	response.IsFinished = response.Phase.Completed
+	return response, nil
+}
 
-	// 終了判定
-	isFinished := llm1Count >= 5 && llm2Count >= 4
+// LLMの発言を1つ生成して保存し、フェーズのある形式では発言順を進める
+func (s *Service) takeTurn(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, role string, onDelta DeltaFunc) (*models.DebateMessage, error) {
+	phase, err := s.expectTurn(session, role)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, llm2Msg, isFinished, nil
+	// 発言の順番がある場合は、LLMを呼び出す前に番を確保し、発言できなければ元に戻す
+	ordered := ordersTurns(session, phase)
+	if ordered {
+		if err := s.advanceTurn(session); err != nil {
+			return nil, err
+		}
+	}
+	msg, err := s.generateTurn(ctx, session, messages, role, phase, onDelta)
+	if err != nil {
+		if ordered {
+			s.rewindTurn(session)
+		}
+		return nil, err
+	}
+	s.startFactCheck(ctx, session, msg)
+	return msg, nil
 }
 
-// ディベートを終了して審査
-func (s *Service) EndDebate(ctx context.Context, sessionID int64) (*models.DebateSession, *models.JudgeResponse, error) {
-	session, err := s.database.GetDebateSession(sessionID)
+// LLMの発言を生成して保存
+func (s *Service) generateTurn(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, role string, phase *models.DebatePhase, onDelta DeltaFunc) (*models.DebateMessage, error) {
+	llmMessages, promptVersion, err := s.buildLLMMessages(ctx, session, messages, role, phase)
 	if err != nil {
-		return nil, nil, fmt.Errorf("session not found: %w", err)
+		return nil, fmt.Errorf("failed to build prompt: %w", err)
 	}
 
-	if session.Status != "active" && session.Status != "ongoing" {
-		return nil, nil, fmt.Errorf("debate has already ended")
+	reply, err := s.generateReply(ctx, session, llmMessages, role, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s response: %w", role, err)
+	}
+	if phase != nil {
+		reply.Argument = truncateRunes(reply.Argument, phase.MaxChars)
 	}
 
-	messages, err := s.database.GetSessionMessages(sessionID)
+	msg, err := s.saveReply(session, role, reply, promptVersion, phaseName(phase))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
+		return nil, fmt.Errorf("failed to save %s message: %w", role, err)
 	}
+	return msg, nil
+}
 
-	// LLM vs LLMの場合のポジション設定
+// セッションの立場からLLMの立場を設定（データベースには保存しない）
+func assignPositions(session *models.DebateSession) {
 	if session.Mode == "llm_vs_llm" {
 		session.LLM1Position = "pro"
 		session.LLM2Position = "con"
+		return
+	}
+	if session.Mode == userVsUser {
+		session.User2Position = opposite(session.UserPosition)
+		return
+	}
+	if session.Mode == teamMode {
+		return
+	}
+	if session.UserPosition == "pro" {
+		session.LLMPosition = "con"
 	} else {
-		// ユーザーポジションからLLMポジションを設定
-		if session.UserPosition == "pro" {
-			session.LLMPosition = "con"
-		} else {
-			session.LLMPosition = "pro"
+		session.LLMPosition = "pro"
+	}
+}
+
+func phaseName(phase *models.DebatePhase) string {
+	if phase == nil {
+		return ""
+	}
+	return phase.Name
+}
+
+// ユーザーの操作でディベートを終了して審査
+// 参加者（LLM vs LLM では作成したユーザー）だけが終了でき、人間どうしの対戦では両方の陣営が発言するまで終了できない
+func (s *Service) EndDebate(ctx context.Context, sessionID, userID int64) (*models.EndDebateResponse, error) {
+	session, err := s.database.GetDebateSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if err := canControl(session, userID); err != nil {
+		return nil, err
+	}
+
+	if (session.Mode == userVsUser || session.Mode == teamMode) && session.Status != "waiting" {
+		messages, err := s.database.GetSessionMessages(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get messages: %w", err)
+		}
+		if !bothSidesSpoke(session, messages) {
+			return nil, fmt.Errorf("%w: the opponent has not replied yet", ErrOutOfTurn)
 		}
 	}
+	return s.endDebate(ctx, sessionID)
+}
+
+// ディベートを終了して審査（時間切れの終了からも呼ぶ）
+func (s *Service) endDebate(ctx context.Context, sessionID int64) (*models.EndDebateResponse, error) {
+	session, err := s.database.GetDebateSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
 
-	// 審査用のメッセージを構築
-	judgeMessages := s.buildJudgeMessages(session, messages)
+	if session.Status == "waiting" {
+		return nil, fmt.Errorf("%w: waiting for the opponent to join", ErrOutOfTurn)
+	}
+	if session.Status != "active" && session.Status != "ongoing" {
+		return nil, fmt.Errorf("debate has already ended")
+	}
 
-	// 審査結果を取得
-	response, err := s.client.ChatCompletionWithSchema(ctx, judgeMessages, "judge_result", openai.JudgeResultSchema)
+	// 実行中のファクトチェックを待つ
+	if session.FactCheck {
+		s.factChecks.wait(sessionID)
+	}
+
+	messages, err := s.database.GetSessionMessages(sessionID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get judge response: %w", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	if session.FactCheck && s.config.FactCheckJudge {
+		if err := s.attachFactChecks(sessionID, messages); err != nil {
+			log.Printf("Failed to get fact checks for session %d: %v", sessionID, err)
+		}
 	}
 
-	var judgeResult models.JudgeResponse
-	if err := json.Unmarshal([]byte(response), &judgeResult); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse judge response: %w", err)
+	// ポジション設定
+	assignPositions(session)
+
+	// 審査員パネルの判定を取得して集計
+	ballots, err := s.castBallots(ctx, session, messages)
+	if err != nil {
+		return nil, err
 	}
+	judgeResult, positionBias := s.decideVerdict(session, ballots)
 
 	// 勝者を決定
 	var winner string
@@ -286,26 +769,16 @@ func (s *Service) EndDebate(ctx context.Context, sessionID int64) (*models.Debat
 		} else {
 			winner = "draw"
 		}
-
-		// ユーザー統計を更新
-		if session.UserID != nil {
-			stats, err := s.database.GetUserStats(*session.UserID)
-			if err != nil {
-				log.Printf("Failed to get user stats: %v", err)
-			} else {
-				stats.TotalDebates++
-				if winner == "user" {
-					stats.Wins++
-				} else if winner == "llm" {
-					stats.Losses++
-				} else {
-					stats.Draws++
-				}
-				if err := s.database.UpdateUserStats(stats); err != nil {
-					log.Printf("Failed to update user stats: %v", err)
-				}
-			}
+	} else if session.Mode == userVsUser {
+		if judgeResult.Winner == session.UserPosition {
+			winner = "user1"
+		} else if judgeResult.Winner == session.User2Position {
+			winner = "user2"
+		} else {
+			winner = "draw"
 		}
+	} else if session.Mode == teamMode {
+		winner = judgeResult.Winner
 	} else {
 		if judgeResult.Winner == "pro" {
 			winner = "llm1"
@@ -316,31 +789,280 @@ func (s *Service) EndDebate(ctx context.Context, sessionID int64) (*models.Debat
 		}
 	}
 
-	// セッションを更新
+	// セッションを終了（審査中に他の要求で終了していれば勝敗は記録しない）
 	now := time.Now()
 	session.Status = "finished"
 	session.Winner = &winner
 	session.JudgeComment = &judgeResult.FinalComment
 	session.FinishedAt = &now
+	session.PositionBias = positionBias
+	session.TurnDeadline = nil
+
+	finished, err := s.database.FinishDebateSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	if !finished {
+		return nil, fmt.Errorf("debate has already ended")
+	}
+	s.recordResult(session, winner)
+
+	// 集計した審査結果と審査員ごとの判定を保存
+	if err := s.database.CreateJudgeResults(judgeResults(session, judgeResult, ballots)); err != nil {
+		log.Printf("Failed to save judge results: %v", err)
+	}
+
+	// ユーザーの発言へのフィードバックを作成（失敗しても審査結果は返す）
+	var feedback *models.FeedbackReport
+	if session.Mode == "user_vs_llm" && s.config.Feedback {
+		feedback, err = s.createFeedback(ctx, session, messages)
+		if err != nil {
+			log.Printf("Failed to create feedback for session %d: %v", session.ID, err)
+		}
+	}
+
+	return &models.EndDebateResponse{
+		Session:     *session,
+		JudgeResult: *judgeResult,
+		Ballots:     ballots,
+		Feedback:    feedback,
+	}, nil
+}
+
+// ディベート参加者としてのLLM応答を生成し、使用量を記録
+// onDeltaが指定された場合、プロバイダがストリーミング対応なら差分を逐次通知し、
+// 非対応なら生成された全文を1つの差分として通知する
+func (s *Service) generateReply(ctx context.Context, session *models.DebateSession, messages []llm.Message, role string, onDelta DeltaFunc) (*models.DebateArgumentResponse, error) {
+	provider, err := s.providerFor(session, role)
+	if err != nil {
+		return nil, err
+	}
+	sampling := s.samplingFor(session, role)
 
-	if err := s.database.UpdateDebateSession(session); err != nil {
-		return nil, nil, fmt.Errorf("failed to update session: %w", err)
+	if session.StructuredTurns {
+		return s.generateStructuredReply(ctx, session, provider, messages, sampling, role, onDelta)
+	}
+
+	var response *llm.Response
+	if streamer, ok := provider.(llm.StreamProvider); ok && onDelta != nil {
+		response, err = streamer.ChatCompletionStream(ctx, messages, sampling, func(delta string) error {
+			return onDelta(role, delta)
+		})
+	} else {
+		response, err = provider.ChatCompletion(ctx, messages, sampling)
+		if err == nil && onDelta != nil {
+			err = onDelta(role, response.Content)
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// 審査結果を保存
-	judgeContent, _ := json.Marshal(judgeResult)
-	_, err = s.database.CreateMessage(sessionID, "judge", string(judgeContent))
+	s.recordUsage(&session.ID, role, response.Usage)
+	return &models.DebateArgumentResponse{Argument: response.Content}, nil
+}
+
+// 主張・要点・反論を構造化出力で生成
+// 構造化出力はストリーミングできないため、onDeltaには主張の全文を1つの差分として通知する
+func (s *Service) generateStructuredReply(ctx context.Context, session *models.DebateSession, provider llm.Provider, messages []llm.Message, sampling llm.Sampling, role string, onDelta DeltaFunc) (*models.DebateArgumentResponse, error) {
+	response, err := provider.ChatCompletionWithSchema(ctx, messages, sampling, s.schemaFor(session.Language, "debate_argument", openai.DebateArgumentSchema))
 	if err != nil {
-		log.Printf("Failed to save judge message: %v", err)
+		s.recordUsage(&session.ID, role, llm.UsageOf(err))
+		return nil, err
+	}
+	s.recordUsage(&session.ID, role, response.Usage)
+
+	var argument models.DebateArgumentResponse
+	if err := json.Unmarshal([]byte(response.Content), &argument); err != nil {
+		return nil, fmt.Errorf("failed to parse argument response: %w", err)
+	}
+
+	if onDelta != nil {
+		if err := onDelta(role, argument.Argument); err != nil {
+			return nil, err
+		}
+	}
+	return &argument, nil
+}
+
+// LLMの応答をメッセージとして保存（構造化モードでは要点と反論も保存）
+func (s *Service) saveReply(session *models.DebateSession, role string, reply *models.DebateArgumentResponse, promptVersion, phase string) (*models.DebateMessage, error) {
+	msg := &models.DebateMessage{
+		SessionID:     session.ID,
+		Role:          role,
+		Content:       reply.Argument,
+		PromptVersion: promptVersion,
+		Phase:         phase,
+		ParticipantID: participantID(session, role),
 	}
+	if session.StructuredTurns {
+		msg.KeyPoints = reply.KeyPoints
+		if msg.KeyPoints == nil {
+			msg.KeyPoints = []string{}
+		}
+		msg.Counterpoint = reply.Counterpoint
+	}
+	return s.database.InsertMessage(msg)
+}
 
-	return session, &judgeResult, nil
+// 終了したセッションの勝敗をモードに応じてユーザー統計に反映し、レーティングの変動を保存
+func (s *Service) recordResult(session *models.DebateSession, winner string) {
+	switch session.Mode {
+	case "user_vs_llm":
+		s.recordUserResult(session, winner)
+	case userVsUser:
+		s.recordMatchResult(session, winner)
+	case teamMode:
+		s.recordTeamResult(session, winner)
+		return
+	default:
+		return
+	}
+	if err := s.database.UpdateRatingChanges(session); err != nil {
+		log.Printf("Failed to update rating changes: %v", err)
+	}
 }
 
-// LLM用のメッセージを構築
-func (s *Service) buildLLMMessages(session *models.DebateSession, messages []models.DebateMessage, role string) []openai.Message {
+// user_vs_llm の勝敗をユーザー統計に反映（レーティングは対戦したAIの難易度で重み付け）
+func (s *Service) recordUserResult(session *models.DebateSession, winner string) {
+	if session.UserID == nil {
+		return
+	}
+	stats, err := s.database.GetUserStats(*session.UserID)
+	if err != nil {
+		log.Printf("Failed to get user stats: %v", err)
+		return
+	}
+
+	stats.TotalDebates++
+	score := 0.5
+	if winner == "user" {
+		stats.Wins++
+		if session.HintsUsed > 0 {
+			stats.AssistedWins++
+		}
+		score = 1
+	} else if winner == "llm" {
+		stats.Losses++
+		score = 0
+	} else {
+		stats.Draws++
+	}
+	rating := updateRating(stats.Rating, session, score)
+	change := rating - stats.Rating
+	session.RatingChange = &change
+	stats.Rating = rating
+	if err := s.database.UpdateUserStats(stats); err != nil {
+		log.Printf("Failed to update user stats: %v", err)
+	}
+}
+
+// 役割に対応するLLMプロバイダを取得（セッションで指定がなければ既定のプロバイダ）
+func (s *Service) providerFor(session *models.DebateSession, role string) (llm.Provider, error) {
+	if p := participantByRole(session, role); p != nil {
+		return s.providers.Get(p.Provider, p.Model)
+	}
+	switch role {
+	case "llm1":
+		return s.providers.Get(session.LLM1Provider, session.LLM1Model)
+	case "llm2":
+		return s.providers.Get(session.LLM2Provider, session.LLM2Model)
+	case "judge", "moderator", "summary", "factcheck", "coach", "feedback":
+		return s.providers.Get(session.JudgeProvider, session.JudgeModel)
+	case "llm":
+		if session.LLMProvider != "" {
+			return s.providers.Get(session.LLMProvider, session.LLMModel)
+		}
+		return s.providers.Default()
+	default:
+		return s.providers.Default()
+	}
+}
+
+// 構造化出力のスキーマに、言語のテンプレートで作成したスキーマに従うための指示を付ける
+// （指示はresponse_formatでスキーマを指定できないプロバイダでのみ使われる）
+func (s *Service) schemaFor(language, name string, schema map[string]any) llm.Schema {
+	result := llm.Schema{Name: name, Schema: schema}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode schema %s: %v", name, err)
+		return result
+	}
+	prompt, err := s.config.Prompts.Render(sessionLanguage(language), "schema", schemaPromptData{Name: name, Schema: string(data)})
+	if err != nil {
+		log.Printf("Failed to render schema instruction: %v", err)
+		return result
+	}
+	result.Instruction = prompt.System
+	return result
+}
+
+// 役割に対応するサンプリングパラメータを取得（セッションに保存がなければサーバーの既定値）
+func (s *Service) samplingFor(session *models.DebateSession, role string) llm.Sampling {
+	if participantByRole(session, role) != nil {
+		return s.config.DebaterSampling.Merge(toSampling(session.DebaterSampling))
+	}
+	switch role {
+	case "llm", "llm1", "llm2":
+		return s.config.DebaterSampling.Merge(toSampling(session.DebaterSampling))
+	case "judge", "moderator", "summary", "factcheck", "coach", "feedback":
+		return s.config.JudgeSampling.Merge(toSampling(session.JudgeSampling))
+	case "topic":
+		return s.config.TopicSampling.Merge(toSampling(session.TopicSampling))
+	default:
+		return llm.Sampling{}
+	}
+}
+
+// 既定値にリクエストの指定を反映し、セッションに保存する形式で返す
+func mergeSampling(defaults llm.Sampling, override *models.SamplingParams) (*models.SamplingParams, error) {
+	merged := defaults.Merge(toSampling(override))
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+	if merged == (llm.Sampling{}) {
+		return nil, nil
+	}
+	return &models.SamplingParams{
+		Temperature: merged.Temperature,
+		TopP:        merged.TopP,
+		MaxTokens:   merged.MaxTokens,
+		Seed:        merged.Seed,
+	}, nil
+}
+
+func toSampling(params *models.SamplingParams) llm.Sampling {
+	if params == nil {
+		return llm.Sampling{}
+	}
+	return llm.Sampling{
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		MaxTokens:   params.MaxTokens,
+		Seed:        params.Seed,
+	}
+}
+
+// LLM呼び出しの使用量とコストを記録
+func (s *Service) recordUsage(sessionID *int64, role string, usage llm.Usage) {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+
+	cost := s.config.Prices.Cost(usage)
+	if err := s.database.CreateUsageRecord(sessionID, role, usage.Model, usage.PromptTokens, usage.CompletionTokens, cost); err != nil {
+		log.Printf("Failed to record LLM usage: %v", err)
+	}
+}
+
+// LLM用のメッセージを構築し、使用したプロンプトのバージョンとともに返す
+// システムプロンプトと最新の発言はそのまま渡し、予算を超える古い発言は要約に置き換える
+// フェーズのある形式ではphaseの指示と文字数の上限を加える
+func (s *Service) buildLLMMessages(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, role string, phase *models.DebatePhase) ([]llm.Message, string, error) {
 	var position string
-	if role == "llm" {
+	if p := participantByRole(session, role); p != nil {
+		position = p.Side
+	} else if role == "llm" {
 		position = session.LLMPosition
 	} else if role == "llm1" {
 		position = session.LLM1Position
@@ -348,97 +1070,170 @@ func (s *Service) buildLLMMessages(session *models.DebateSession, messages []mod
 		position = session.LLM2Position
 	}
 
-	positionDesc := "賛成"
-	if position == "con" {
-		positionDesc = "反対"
+	level := difficultyOf(session)
+	data := debaterPromptData{
+		Topic:      session.Topic,
+		Position:   position,
+		Structured: session.StructuredTurns,
+		ReplyChars: level.ReplyChars,
+		ReplyWords: level.ReplyChars / 2,
+	}
+	if role == "llm" {
+		persona, err := s.personaPrompt(session)
+		if err != nil {
+			return nil, "", err
+		}
+		data.Persona = persona
+		data.Difficulty, err = s.difficultyPrompt(session)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if phase != nil {
+		data.Phase = phase.Name
+		data.PhaseTitle, data.PhaseInstruction = s.phaseText(session, phase)
+		data.MaxChars = phase.MaxChars
 	}
 
-	systemPrompt := fmt.Sprintf(`あなたはディベートの参加者です。
-テーマ: %s
-あなたの立場: %s側
-
-以下のルールに従ってディベートを行ってください：
-1. 自分の立場を論理的に主張してください
-2. 相手の主張に対して適切に反論してください
-3. 具体的な例やデータを用いて説得力のある議論をしてください
-4. 礼儀正しく、建設的な議論を心がけてください
-5. 回答は300文字程度にまとめてください`, session.Topic, positionDesc)
+	prompt, err := s.config.Prompts.Render(sessionLanguage(session.Language), "debater", data)
+	if err != nil {
+		return nil, "", err
+	}
 
-	llmMessages := []openai.Message{
-		{Role: "system", Content: systemPrompt},
+	llmMessages := []llm.Message{
+		{Role: "system", Content: prompt.System},
 	}
 
-	for _, msg := range messages {
-		if msg.Role == "system" {
-			continue
+	h := s.compactHistory(ctx, session, messages, s.config.ContextTokens-llm.EstimateTokens(prompt.System))
+	if h.summary != "" {
+		summary, err := s.config.Prompts.RenderBlock(sessionLanguage(session.Language), "debater", "summary", debaterPromptData{Summary: h.summary})
+		if err != nil {
+			return nil, "", err
 		}
+		llmMessages = append(llmMessages, llm.Message{Role: "system", Content: summary})
+	}
 
+	for _, msg := range h.recent {
 		msgRole := "user"
+		content := msg.Content
 		if msg.Role == role {
 			msgRole = "assistant"
+		} else if p := participantByRole(session, msg.Role); p != nil {
+			// チーム戦では味方と相手の発言を区別できるよう発言者を付ける
+			content = participantLabel(session, p) + ": " + content
 		}
 
-		llmMessages = append(llmMessages, openai.Message{
+		llmMessages = append(llmMessages, llm.Message{
 			Role:    msgRole,
-			Content: msg.Content,
+			Content: content,
 		})
 	}
 
-	return llmMessages
+	return llmMessages, prompt.Version, nil
 }
 
-// 審査用のメッセージを構築
-func (s *Service) buildJudgeMessages(session *models.DebateSession, messages []models.DebateMessage) []openai.Message {
-	systemPrompt := fmt.Sprintf(`あなたは公平なディベートの審査員です。
-以下のディベートを評価し、勝者を決定してください。
+// 審査員パネルに渡す議論の記録を作成
+// 審査員には予算内であれば全発言をそのまま渡し、超える場合のみ序盤を要約に置き換える
+// 発言の記録以外の部分で使うトークン数は、観点の説明が最も長い審査員に合わせて見積もる
+// swappedの場合は位置バイアスの確認用に、立場の表示と発言順を入れ替える
+func (s *Service) judgeTranscript(ctx context.Context, session *models.DebateSession, messages []models.DebateMessage, panel []models.JudgeSpec, swapped bool) (string, error) {
+	reserved := 0
+	for _, spec := range panel {
+		judgeMessages, _, err := s.buildJudgeMessages(session, "", spec.Persona)
+		if err != nil {
+			return "", err
+		}
+		reserved = max(reserved, llm.EstimateMessagesTokens(judgeMessages))
+	}
+	notes := s.factCheckNotes(session, messages, swapped)
+	roster := teamRoster(session)
+	if swapped {
+		swappedSession, _ := swapSides(session, nil)
+		roster = teamRoster(swappedSession)
+	}
+	reserved += llm.EstimateTokens(notes) + llm.EstimateTokens(roster)
+	if swapped {
+		return roster + s.swappedTranscript(ctx, session, messages, s.config.JudgeContextTokens-reserved) + notes, nil
+	}
+	return roster + s.transcript(ctx, session, messages, s.config.JudgeContextTokens-reserved) + notes, nil
+}
 
-テーマ: %s
-賛成側(pro): 賛成の立場
-反対側(con): 反対の立場
+// 審査用のメッセージを構築し、使用したプロンプトのバージョンとともに返す
+func (s *Service) buildJudgeMessages(session *models.DebateSession, transcript, persona string) ([]llm.Message, string, error) {
+	personaText, err := s.judgePersona(session, persona)
+	if err != nil {
+		return nil, "", err
+	}
 
-評価基準：
-1. 論理性：主張の論理的整合性
-2. 説得力：具体的な根拠やデータの使用
-3. 反論力：相手の主張への効果的な反論
-4. 表現力：わかりやすく説得力のある表現
+	prompt, err := s.config.Prompts.Render(sessionLanguage(session.Language), "judge", judgePromptData{
+		Topic:      session.Topic,
+		Transcript: transcript,
+		Persona:    personaText,
+	})
+	if err != nil {
+		return nil, "", err
+	}
 
-公平に両者を評価し、結果を出してください。`, session.Topic)
+	return []llm.Message{
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}, prompt.Version, nil
+}
 
-	debateContent := "【ディベートの内容】\n\n"
+// 審査・司会用にディベートの発言を立場付きのテキストにまとめる（フェーズのある発言はフェーズ名も付ける）
+func (s *Service) formatTranscript(session *models.DebateSession, messages []models.DebateMessage) string {
+	text := textFor(sessionLanguage(session.Language))
+	debateContent := text.Transcript
 	for _, msg := range messages {
-		if msg.Role == "system" || msg.Role == "judge" {
+		if !isTurn(msg) {
 			continue
 		}
 
-		var speaker string
-		switch msg.Role {
-		case "user":
-			if session.UserPosition == "pro" {
-				speaker = "賛成側(ユーザー)"
-			} else {
-				speaker = "反対側(ユーザー)"
-			}
-		case "llm":
-			if session.LLMPosition == "pro" {
-				speaker = "賛成側(AI)"
-			} else {
-				speaker = "反対側(AI)"
-			}
-		case "llm1":
-			speaker = "賛成側(AI-1)"
-		case "llm2":
-			speaker = "反対側(AI-2)"
+		speaker := speakerLabel(session, msg.Role)
+		if msg.Phase != "" {
+			speaker = fmt.Sprintf("[%s] %s", s.phaseTitle(session, msg.Phase), speaker)
 		}
-
 		debateContent += fmt.Sprintf("%s:\n%s\n\n", speaker, msg.Content)
 	}
+	return debateContent
+}
 
-	return []openai.Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: debateContent + "\n上記のディベートを評価してください。"},
+// 発言者の立場付きの表示名
+func speakerLabel(session *models.DebateSession, role string) string {
+	text := textFor(sessionLanguage(session.Language))
+	switch role {
+	case "user", "user1":
+		if session.UserPosition == "pro" {
+			return text.ProUser
+		}
+		return text.ConUser
+	case "user2":
+		if session.User2Position == "pro" {
+			return text.ProUser
+		}
+		return text.ConUser
+	case "llm":
+		if session.LLMPosition == "pro" {
+			return text.ProAI
+		}
+		return text.ConAI
+	case "llm1":
+		return text.ProAI1
+	case "llm2":
+		return text.ConAI2
+	default:
+		if p := participantByRole(session, role); p != nil {
+			return participantLabel(session, p)
+		}
+		return ""
 	}
 }
 
+// 審査員の位置バイアスの確認結果を集計
+func (s *Service) GetBiasStats() (*models.BiasStats, error) {
+	return s.database.GetBiasStats()
+}
+
 // ユーザーの統計を取得
 func (s *Service) GetUserStats(userID int64) (*models.UserStats, error) {
 	return s.database.GetUserStats(userID)
@@ -449,6 +1244,16 @@ func (s *Service) GetUserDebateHistory(userID int64) ([]models.DebateSession, er
 	return s.database.GetUserDebateHistory(userID)
 }
 
+// ユーザーのLLM使用量を取得
+func (s *Service) GetUserUsage(userID int64) (*models.UserUsage, error) {
+	return s.database.GetUserUsage(userID)
+}
+
+// セッションのLLM使用量を取得
+func (s *Service) GetSessionUsage(sessionID int64) (*models.SessionUsage, error) {
+	return s.database.GetSessionUsage(sessionID)
+}
+
 // ディベートの詳細を取得
 func (s *Service) GetDebateDetail(sessionID int64) (*models.DebateSession, []models.DebateMessage, error) {
 	session, err := s.database.GetDebateSession(sessionID)
@@ -460,6 +1265,28 @@ func (s *Service) GetDebateDetail(sessionID int64) (*models.DebateSession, []mod
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := s.attachFactChecks(sessionID, messages); err != nil {
+		return nil, nil, err
+	}
 
 	return session, messages, nil
 }
+
+// セッションの審査結果を取得（集計した判定と審査員ごとの判定、未審査ならnil）
+func (s *Service) GetJudgeResults(sessionID int64) (*models.JudgeResult, []models.JudgeResult, error) {
+	results, err := s.database.GetJudgeResults(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var verdict *models.JudgeResult
+	var ballots []models.JudgeResult
+	for i := range results {
+		if results[i].Kind == "verdict" {
+			verdict = &results[i]
+		} else {
+			ballots = append(ballots, results[i])
+		}
+	}
+	return verdict, ballots, nil
+}
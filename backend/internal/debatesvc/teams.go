@@ -0,0 +1,274 @@
+package debatesvc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// チーム戦（各側に人間とAIを混ぜた複数の発言者）
+// 各側の発言者は発言順に交代で発言し、メッセージの役割は参加者の役割（"pro1" など）
+const teamMode = "team"
+
+// 1つの側の発言者の上限
+const maxTeamSize = 4
+
+// 参加者の種類
+const (
+	kindHuman = "human"
+	kindAI    = "ai"
+)
+
+// セッション作成時にチーム戦の参加者を決定する
+// 作成したユーザーはuserPositionの側（空ならどちらでも）の最初の人間の枠に入る
+func (s *Service) resolveParticipants(mode string, specs []models.ParticipantSpec, userID *int64, userPosition string) ([]models.Participant, error) {
+	if mode != teamMode {
+		if len(specs) > 0 {
+			return nil, fmt.Errorf("participants are only available in team mode")
+		}
+		return nil, nil
+	}
+
+	counts := map[string]int{}
+	participants := make([]models.Participant, 0, len(specs))
+	for i, spec := range specs {
+		if spec.Side != "pro" && spec.Side != "con" {
+			return nil, fmt.Errorf("participant %d: invalid side %q", i+1, spec.Side)
+		}
+		counts[spec.Side]++
+		p := models.Participant{
+			Role:         fmt.Sprintf("%s%d", spec.Side, counts[spec.Side]),
+			Side:         spec.Side,
+			SpeakerOrder: counts[spec.Side],
+			Kind:         spec.Kind,
+		}
+		switch spec.Kind {
+		case kindHuman:
+			if spec.Provider != "" || spec.Model != "" {
+				return nil, fmt.Errorf("participant %d: provider and model are only for ai participants", i+1)
+			}
+		case kindAI:
+			var err error
+			p.Provider, p.Model, err = s.providers.Resolve(spec.Provider, spec.Model)
+			if err != nil {
+				return nil, fmt.Errorf("participant %d: %v", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("participant %d: invalid kind %q (human or ai)", i+1, spec.Kind)
+		}
+		participants = append(participants, p)
+	}
+	for _, side := range []string{"pro", "con"} {
+		if counts[side] == 0 || counts[side] > maxTeamSize {
+			return nil, fmt.Errorf("each side needs 1 to %d participants", maxTeamSize)
+		}
+	}
+
+	if userID != nil {
+		for i := range participants {
+			p := &participants[i]
+			if p.Kind == kindHuman && (userPosition == "" || userPosition == "random" || p.Side == userPosition) {
+				p.UserID = userID
+				return participants, nil
+			}
+		}
+		if userPosition != "" && userPosition != "random" {
+			return nil, fmt.Errorf("no human participant on the %s side for the creator", userPosition)
+		}
+	}
+	return participants, nil
+}
+
+// 人間の枠がすべて埋まっているか
+func allJoined(participants []models.Participant) bool {
+	for _, p := range participants {
+		if p.Kind == kindHuman && p.UserID == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// 役割に対応するチーム戦の参加者（チーム戦でなければnil）
+func participantByRole(session *models.DebateSession, role string) *models.Participant {
+	for i := range session.Participants {
+		if session.Participants[i].Role == role {
+			return &session.Participants[i]
+		}
+	}
+	return nil
+}
+
+// 役割に対応する参加者のID（チーム戦でなければnil）
+func participantID(session *models.DebateSession, role string) *int64 {
+	if p := participantByRole(session, role); p != nil {
+		return &p.ID
+	}
+	return nil
+}
+
+// ユーザーがチーム戦で発言する参加者
+func participantByUser(session *models.DebateSession, userID int64) *models.Participant {
+	for i := range session.Participants {
+		if p := &session.Participants[i]; p.UserID != nil && *p.UserID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+// チーム戦でturnIndex番目の発言をする参加者
+// 発言する側はフェーズの発言順（フェーズのない形式では賛成側から交互）で決まり、側の中では発言順に交代する
+func teamSpeaker(session *models.DebateSession, format models.DebateFormat, turnIndex int) *models.Participant {
+	side := "pro"
+	nth := turnIndex / 2
+	if len(format.Phases) > 0 {
+		_, side = turnAt(format, turnIndex)
+		nth = 0
+		for i := 0; i < turnIndex; i++ {
+			if _, other := turnAt(format, i); other == side {
+				nth++
+			}
+		}
+	} else if turnIndex%2 == 1 {
+		side = "con"
+	}
+
+	var team []*models.Participant
+	for i := range session.Participants {
+		if session.Participants[i].Side == side {
+			team = append(team, &session.Participants[i])
+		}
+	}
+	if len(team) == 0 {
+		return nil
+	}
+	return team[nth%len(team)]
+}
+
+// チーム戦の参加者の立場付きの表示名
+func participantLabel(session *models.DebateSession, p *models.Participant) string {
+	text := textFor(sessionLanguage(session.Language))
+	side, kind := text.ProSide, text.HumanKind
+	if p.Side == "con" {
+		side = text.ConSide
+	}
+	if p.Kind == kindAI {
+		kind = text.AIKind
+	}
+	return fmt.Sprintf(text.TeamSpeaker, side, p.SpeakerOrder, kind)
+}
+
+// 審査員に渡す、側ごとのチームの構成（チーム戦でなければ空）
+func teamRoster(session *models.DebateSession) string {
+	if session.Mode != teamMode {
+		return ""
+	}
+	text := textFor(sessionLanguage(session.Language))
+	var roster strings.Builder
+	roster.WriteString(text.TeamRoster)
+	for _, side := range []string{"pro", "con"} {
+		var members []string
+		for i := range session.Participants {
+			if p := &session.Participants[i]; p.Side == side {
+				members = append(members, participantLabel(session, p))
+			}
+		}
+		fmt.Fprintf(&roster, "- %s\n", strings.Join(members, ", "))
+	}
+	return roster.String() + "\n"
+}
+
+// チーム戦の勝敗を人間の参加者のユーザー統計に反映
+// レーティングは相手の側の平均（AIは標準の難易度の強さ）を相手として計算する
+func (s *Service) recordTeamResult(session *models.DebateSession, winner string) {
+	ratings := map[int64]float64{}
+	sideRating := map[string][]float64{}
+	stats := map[int64]*models.UserStats{}
+	for _, p := range session.Participants {
+		rating := difficultyLevels[defaultDifficulty].Rating
+		if p.UserID != nil {
+			st, err := s.database.GetUserStats(*p.UserID)
+			if err != nil {
+				log.Printf("Failed to get user stats: %v", err)
+				return
+			}
+			stats[p.ID] = st
+			rating = st.Rating
+		}
+		ratings[p.ID] = rating
+		sideRating[p.Side] = append(sideRating[p.Side], rating)
+	}
+
+	for i := range session.Participants {
+		p := &session.Participants[i]
+		st, ok := stats[p.ID]
+		if !ok {
+			continue
+		}
+
+		st.TotalDebates++
+		score := 0.5
+		switch winner {
+		case p.Side:
+			st.Wins++
+			score = 1
+		case opposite(p.Side):
+			st.Losses++
+			score = 0
+		default:
+			st.Draws++
+		}
+		opponents := sideRating[opposite(p.Side)]
+		var opponent float64
+		for _, r := range opponents {
+			opponent += r
+		}
+		opponent /= float64(len(opponents))
+
+		st.Rating = eloRating(ratings[p.ID], opponent, score)
+		change := st.Rating - ratings[p.ID]
+		p.RatingChange = &change
+		if err := s.database.UpdateUserStats(st); err != nil {
+			log.Printf("Failed to update user stats: %v", err)
+		}
+		if err := s.database.UpdateParticipantRating(p.ID, change); err != nil {
+			log.Printf("Failed to update participant rating: %v", err)
+		}
+	}
+}
+
+// チーム戦の空いている人間の枠に参加し、すべての枠が埋まったら開始する
+func (s *Service) joinTeam(session *models.DebateSession, userID int64, side string) (*models.DebateSession, error) {
+	if side != "" && side != "pro" && side != "con" {
+		return nil, fmt.Errorf("%w: invalid side %q", ErrInvalidRequest, side)
+	}
+	if participantByUser(session, userID) != nil {
+		return nil, fmt.Errorf("%w: you have already joined this debate", ErrInvalidRequest)
+	}
+
+	joined, err := s.database.JoinParticipant(session.ID, userID, side)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join session: %w", err)
+	}
+	if !joined {
+		return nil, fmt.Errorf("%w: no open seat in this debate", ErrOutOfTurn)
+	}
+
+	session, err = s.database.GetDebateSession(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if !allJoined(session.Participants) {
+		return session, nil
+	}
+
+	s.startClocks(session)
+	if _, err := s.database.StartDebateSession(session.ID, session.Deadline); err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	session.Status = "active"
+	return session, nil
+}
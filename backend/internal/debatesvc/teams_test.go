@@ -0,0 +1,217 @@
+package debatesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 賛成側pro人・反対側con人のチーム戦のセッション（参加者は全員人間）
+func teamSession(pro, con int) *models.DebateSession {
+	session := &models.DebateSession{Mode: teamMode}
+	for _, team := range []struct {
+		side string
+		size int
+	}{{"pro", pro}, {"con", con}} {
+		for i := 1; i <= team.size; i++ {
+			session.Participants = append(session.Participants, models.Participant{
+				Role: fmt.Sprintf("%s%d", team.side, i), Side: team.side, SpeakerOrder: i, Kind: kindHuman,
+			})
+		}
+	}
+	return session
+}
+
+func TestTeamSpeaker(t *testing.T) {
+	formats := DefaultFormats()
+	tests := []struct {
+		name     string
+		format   string
+		pro, con int
+		want     []string // 発言順の役割（全フェーズ終了後は空）
+	}{
+		{"free 1v1", freeFormat, 1, 1, []string{"pro1", "con1", "pro1", "con1"}},
+		{"free 2v2", freeFormat, 2, 2, []string{"pro1", "con1", "pro2", "con2", "pro1", "con1"}},
+		{"free 2v3", freeFormat, 2, 3, []string{"pro1", "con1", "pro2", "con2", "pro1", "con3", "pro2", "con1"}},
+		// quick: 賛成・反対 / 反対・賛成
+		{"quick 1v1", "quick", 1, 1, []string{"pro1", "con1", "con1", "pro1", ""}},
+		{"quick 2v2", "quick", 2, 2, []string{"pro1", "con1", "con2", "pro2", ""}},
+		// standard: 賛成・反対 / 反対・賛成 / 賛成・反対・賛成・反対 / 反対・賛成
+		{"standard 2v3", "standard", 2, 3, []string{"pro1", "con1", "con2", "pro2", "pro1", "con3", "pro2", "con1", "con2", "pro1", ""}},
+		{"standard 3v1", "standard", 3, 1, []string{"pro1", "con1", "con1", "pro2", "pro3", "con1", "pro1", "con1", "con1", "pro2", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := teamSession(tt.pro, tt.con)
+			for i, want := range tt.want {
+				var got string
+				if p := teamSpeaker(session, formats[tt.format], i); p != nil {
+					got = p.Role
+				}
+				if got != want {
+					t.Errorf("turn %d: speaker = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveParticipants(t *testing.T) {
+	s := NewService(nil, fakeRegistry(nil), Config{})
+	creator := int64(1)
+	human := func(side string) models.ParticipantSpec { return models.ParticipantSpec{Side: side, Kind: kindHuman} }
+	ai := func(side string) models.ParticipantSpec { return models.ParticipantSpec{Side: side, Kind: kindAI} }
+
+	tests := []struct {
+		name     string
+		mode     string
+		specs    []models.ParticipantSpec
+		userID   *int64
+		position string
+		wantErr  bool
+		wantSeat string // 作成したユーザーが入る役割（入らない場合は空）
+	}{
+		{"creator takes the first human seat of the side", teamMode, []models.ParticipantSpec{ai("pro"), human("pro"), human("con")}, &creator, "pro", false, "pro2"},
+		{"creator takes any side when random", teamMode, []models.ParticipantSpec{ai("pro"), human("con"), human("con")}, &creator, "random", false, "con1"},
+		{"creator without a position", teamMode, []models.ParticipantSpec{human("con"), human("pro")}, &creator, "", false, "con1"},
+		{"no human seat on the creator's side", teamMode, []models.ParticipantSpec{ai("pro"), human("con")}, &creator, "pro", true, ""},
+		{"no human seat at all", teamMode, []models.ParticipantSpec{ai("pro"), ai("con")}, &creator, "", false, ""},
+		{"without a creator", teamMode, []models.ParticipantSpec{human("pro"), human("con")}, nil, "pro", false, ""},
+		{"side without members", teamMode, []models.ParticipantSpec{human("pro"), ai("pro")}, &creator, "pro", true, ""},
+		{"no participants", teamMode, nil, &creator, "", true, ""},
+		{"side over the limit", teamMode, []models.ParticipantSpec{human("pro"), ai("pro"), ai("pro"), ai("pro"), ai("pro"), ai("con")}, &creator, "pro", true, ""},
+		{"side at the limit", teamMode, []models.ParticipantSpec{human("pro"), ai("pro"), ai("pro"), ai("pro"), ai("con")}, &creator, "pro", false, "pro1"},
+		{"invalid side", teamMode, []models.ParticipantSpec{human("pro"), {Side: "neutral", Kind: kindAI}}, &creator, "pro", true, ""},
+		{"invalid kind", teamMode, []models.ParticipantSpec{human("pro"), {Side: "con", Kind: "robot"}}, &creator, "pro", true, ""},
+		{"model for a human", teamMode, []models.ParticipantSpec{human("pro"), {Side: "con", Kind: kindHuman, Model: "fake-model"}}, &creator, "pro", true, ""},
+		{"unknown provider", teamMode, []models.ParticipantSpec{human("pro"), {Side: "con", Kind: kindAI, Provider: "nope"}}, &creator, "pro", true, ""},
+		{"participants outside team mode", "user_vs_llm", []models.ParticipantSpec{human("pro"), human("con")}, &creator, "pro", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			participants, err := s.resolveParticipants(tt.mode, tt.specs, tt.userID, tt.position)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveParticipants succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveParticipants: %v", err)
+			}
+
+			var seat string
+			for _, p := range participants {
+				if p.UserID != nil {
+					if seat != "" {
+						t.Fatalf("creator has two seats: %s and %s", seat, p.Role)
+					}
+					seat = p.Role
+				}
+			}
+			if seat != tt.wantSeat {
+				t.Errorf("creator seat = %q, want %q", seat, tt.wantSeat)
+			}
+		})
+	}
+}
+
+// 参加した順に空いている人間の枠に入り、すべての枠が埋まった時点で開始する
+func TestJoinTeam(t *testing.T) {
+	ctx := context.Background()
+
+	env := NewTestEnv(t, nil)
+	s := env.Service
+	users := map[string]int64{"alice": env.User.ID}
+	for _, name := range []string{"bob", "carol"} {
+		users[name] = env.AddUser(t, name)
+	}
+
+	session, _, err := s.CreateDebateSession(ctx, &env.User.ID, &models.CreateDebateRequest{
+		Mode:         teamMode,
+		Topic:        "学校の制服は廃止すべきか",
+		UserPosition: "pro",
+		Participants: []models.ParticipantSpec{
+			{Side: "pro", Kind: kindHuman},
+			{Side: "pro", Kind: kindAI},
+			{Side: "con", Kind: kindHuman},
+			{Side: "con", Kind: kindHuman},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateDebateSession: %v", err)
+	}
+	if session.Status != "waiting" {
+		t.Fatalf("status = %q before the seats are filled, want waiting", session.Status)
+	}
+
+	joined, err := s.JoinDebate(ctx, users["bob"], session.InviteCode, "con")
+	if err != nil {
+		t.Fatalf("bob joins: %v", err)
+	}
+	if p := participantByUser(joined, users["bob"]); p == nil || p.Role != "con1" {
+		t.Fatalf("bob's seat = %+v, want con1", p)
+	}
+	if joined.Status != "waiting" {
+		t.Fatalf("status = %q with an open seat, want waiting", joined.Status)
+	}
+
+	if _, err := s.JoinDebate(ctx, users["bob"], session.InviteCode, ""); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("bob joins twice: err = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := s.JoinDebate(ctx, users["carol"], session.InviteCode, "pro"); !errors.Is(err, ErrOutOfTurn) {
+		t.Errorf("carol joins a full side: err = %v, want ErrOutOfTurn", err)
+	}
+
+	joined, err = s.JoinDebate(ctx, users["carol"], session.InviteCode, "")
+	if err != nil {
+		t.Fatalf("carol joins: %v", err)
+	}
+	if p := participantByUser(joined, users["carol"]); p == nil || p.Role != "con2" {
+		t.Fatalf("carol's seat = %+v, want con2", p)
+	}
+	if joined.Status != "active" {
+		t.Errorf("status = %q with all seats filled, want active", joined.Status)
+	}
+}
+
+func TestCanControl(t *testing.T) {
+	creator, member, outsider := int64(1), int64(2), int64(3)
+	seated := teamSession(1, 1)
+	seated.CreatedBy = &creator
+	seated.Participants[1].UserID = &member
+	// 作成したユーザーが枠に入らない、AIだけのチーム戦
+	seatless := &models.DebateSession{Mode: teamMode, CreatedBy: &creator, Participants: []models.Participant{
+		{Role: "pro1", Side: "pro", SpeakerOrder: 1, Kind: kindAI},
+		{Role: "con1", Side: "con", SpeakerOrder: 1, Kind: kindAI},
+	}}
+	versus := &models.DebateSession{Mode: userVsUser, UserID: &creator, CreatedBy: &creator, User2ID: &member}
+	llmOnly := &models.DebateSession{Mode: "llm_vs_llm", CreatedBy: &creator}
+
+	tests := []struct {
+		name    string
+		session *models.DebateSession
+		userID  int64
+		wantErr error
+	}{
+		{"team creator without a seat", seatless, creator, nil},
+		{"team outsider without seats", seatless, member, ErrNotParticipant},
+		{"team creator", seated, creator, nil},
+		{"team member", seated, member, nil},
+		{"team outsider", seated, outsider, ErrNotParticipant},
+		{"user_vs_user participant", versus, member, nil},
+		{"user_vs_user outsider", versus, outsider, ErrNotParticipant},
+		{"llm_vs_llm creator", llmOnly, creator, nil},
+		{"llm_vs_llm other user", llmOnly, member, ErrNotParticipant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := canControl(tt.session, tt.userID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("canControl = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
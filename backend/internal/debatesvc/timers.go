@@ -0,0 +1,205 @@
+package debatesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 時間切れで放置されたセッションの終わらせ方
+const (
+	TimeoutJudge   = "judge"   // それまでの発言で審査する
+	TimeoutForfeit = "forfeit" // user_vs_llm ではユーザーの不戦敗とする（llm_vs_llm は審査）
+)
+
+// セッションごとに指定できる持ち時間の範囲（秒）
+const (
+	minTurnSeconds  = 10
+	maxTurnSeconds  = 3600
+	minTotalSeconds = 60
+	maxTotalSeconds = 24 * 3600
+)
+
+// ユーザーが続けてこの回数分の持ち時間を過ぎても発言しなければ放置とみなす
+const abandonAfterTurns = 3
+
+// ディベート全体の持ち時間を過ぎたセッションにメッセージを送ったときのエラー（APIでは409として扱う）
+var ErrTimeLimit = errors.New("time limit exceeded")
+
+// セッション作成時に持ち時間を決定（指定がなければサーバーの既定値）
+func (s *Service) resolveTimeLimits(session *models.DebateSession, req *models.CreateDebateRequest) error {
+	turn := int(s.config.TurnLimit / time.Second)
+	if req.TurnSeconds != nil {
+		turn = *req.TurnSeconds
+		if turn != 0 && (turn < minTurnSeconds || turn > maxTurnSeconds) {
+			return fmt.Errorf("turn_seconds must be 0 or between %d and %d", minTurnSeconds, maxTurnSeconds)
+		}
+		if turn != 0 && req.Mode != "user_vs_llm" {
+			return fmt.Errorf("turn_seconds is only available in user_vs_llm mode")
+		}
+	}
+	if req.Mode != "user_vs_llm" {
+		turn = 0
+	}
+
+	total := int(s.config.TotalLimit / time.Second)
+	if req.TotalSeconds != nil {
+		total = *req.TotalSeconds
+		if total != 0 && (total < minTotalSeconds || total > maxTotalSeconds) {
+			return fmt.Errorf("total_seconds must be 0 or between %d and %d", minTotalSeconds, maxTotalSeconds)
+		}
+	}
+
+	session.TurnSeconds = turn
+	session.TotalSeconds = total
+	return nil
+}
+
+// 作成したセッションの持ち時間の計測を始める（テーマと立場が決まった後に呼ぶ）
+func (s *Service) startClocks(session *models.DebateSession) {
+	if session.TotalSeconds > 0 {
+		deadline := time.Now().Add(time.Duration(session.TotalSeconds) * time.Second)
+		session.Deadline = &deadline
+	}
+	s.startTurnClock(session)
+}
+
+// 次がユーザーの番なら持ち時間の期限を設定する（ユーザーの番でなければ期限なし）
+func (s *Service) startTurnClock(session *models.DebateSession) {
+	session.TurnDeadline = nil
+	if session.TurnSeconds == 0 || session.Mode != "user_vs_llm" {
+		return
+	}
+	if status := s.phaseStatus(session); status != nil && (status.Completed || status.NextSpeaker != "user") {
+		return
+	}
+	deadline := time.Now().Add(time.Duration(session.TurnSeconds) * time.Second)
+	session.TurnDeadline = &deadline
+}
+
+// 発言の後にユーザーの番の期限を更新して保存（持ち時間のないセッションでは何もしない）
+func (s *Service) restartTurnClock(session *models.DebateSession) error {
+	if session.TurnSeconds == 0 {
+		return nil
+	}
+	s.startTurnClock(session)
+	_, err := s.database.UpdateSessionProgress(session, session.TurnIndex)
+	return err
+}
+
+// 時間切れで終了させる理由（まだ期限内なら空）
+func expiryReason(session *models.DebateSession, now time.Time) string {
+	text := textFor(sessionLanguage(session.Language))
+	if session.Deadline != nil && now.After(*session.Deadline) {
+		return fmt.Sprintf(text.TimeLimitReason, time.Duration(session.TotalSeconds)*time.Second)
+	}
+	if session.TurnDeadline != nil {
+		grace := time.Duration((abandonAfterTurns-1)*session.TurnSeconds) * time.Second
+		if now.After(session.TurnDeadline.Add(grace)) {
+			return fmt.Sprintf(text.AbandonedReason, abandonAfterTurns)
+		}
+	}
+	return ""
+}
+
+// 時間切れのセッションを設定された方法で終了
+func (s *Service) expireSession(ctx context.Context, session *models.DebateSession, reason string) error {
+	session.EndReason = reason
+	session.TurnDeadline = nil
+	if s.config.TimeoutOutcome == TimeoutForfeit && session.Mode == "user_vs_llm" {
+		return s.forfeit(session)
+	}
+
+	if err := s.database.SetEndReason(session.ID, reason); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	_, err := s.endDebate(ctx, session.ID)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	// 審査に失敗した場合も勝敗なしで終了させ、スイーパーが審査員パネルを呼び出し続けないようにする
+	log.Printf("Failed to judge expired session %d, finishing without a verdict: %v", session.ID, err)
+	return s.finishWithoutVerdict(session)
+}
+
+// 審査せずに勝敗なしで終了（ユーザー統計には反映しない）
+func (s *Service) finishWithoutVerdict(session *models.DebateSession) error {
+	comment := session.EndReason + textFor(sessionLanguage(session.Language)).NoVerdict
+	now := time.Now()
+	session.Status = "finished"
+	session.Winner = nil
+	session.JudgeComment = &comment
+	session.FinishedAt = &now
+
+	finished, err := s.database.FinishDebateSession(session)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if !finished {
+		return fmt.Errorf("debate has already ended")
+	}
+	return nil
+}
+
+// 審査せずにユーザーの不戦敗として終了
+func (s *Service) forfeit(session *models.DebateSession) error {
+	assignPositions(session)
+
+	winner := "llm"
+	now := time.Now()
+	session.Status = "finished"
+	session.Winner = &winner
+	session.JudgeComment = &session.EndReason
+	session.FinishedAt = &now
+
+	finished, err := s.database.FinishDebateSession(session)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if !finished {
+		return fmt.Errorf("debate has already ended")
+	}
+	s.recordResult(session, winner)
+	return nil
+}
+
+// 一定間隔で放置されたセッションを探して終了させる（ctxが終了するまで続ける）
+func (s *Service) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *Service) sweep(ctx context.Context) {
+	sessions, err := s.database.GetTimedSessions()
+	if err != nil {
+		log.Printf("Failed to get timed sessions: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range sessions {
+		session := &sessions[i]
+		reason := expiryReason(session, now)
+		if reason == "" {
+			continue
+		}
+		if err := s.expireSession(ctx, session, reason); err != nil {
+			log.Printf("Failed to finish expired session %d: %v", session.ID, err)
+			continue
+		}
+		log.Printf("Finished expired session %d (%s)", session.ID, s.config.TimeoutOutcome)
+	}
+}
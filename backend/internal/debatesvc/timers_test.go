@@ -0,0 +1,108 @@
+package debatesvc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/fakellm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// 発言は生成できるが、構造化出力を使う審査はすべて失敗するプロバイダ
+type judgeDown struct {
+	*fakellm.Scripted
+}
+
+func (p judgeDown) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	return nil, &llm.Error{Kind: llm.ErrorUnavailable, StatusCode: 503, Err: errors.New("service unavailable")}
+}
+
+// 番の持ち時間を過ぎたセッション（持ち時間60秒、期限をagoだけ前に設定）
+func overdueSession(t *testing.T, env *TestEnv, ago time.Duration) *models.DebateSession {
+	t.Helper()
+	turnSeconds := 60
+	session, _, err := env.Service.CreateDebateSession(context.Background(), &env.User.ID, &models.CreateDebateRequest{
+		Mode:         "user_vs_llm",
+		Topic:        "学校の制服は廃止すべきか",
+		UserPosition: "pro",
+		TurnSeconds:  &turnSeconds,
+	})
+	if err != nil {
+		t.Fatalf("CreateDebateSession: %v", err)
+	}
+
+	deadline := time.Now().Add(-ago)
+	session.TurnDeadline = &deadline
+	if _, err := env.DB.UpdateSessionProgress(session, session.TurnIndex); err != nil {
+		t.Fatalf("UpdateSessionProgress: %v", err)
+	}
+	return session
+}
+
+// 番の持ち時間を過ぎた発言は保存せず、パスとして数えて次の持ち時間を始める
+func TestLateMessage(t *testing.T) {
+	ctx := context.Background()
+	env := NewTestEnv(t, nil)
+	session := overdueSession(t, env, 10*time.Second)
+
+	if _, err := env.Service.ProcessUserMessage(ctx, session.ID, env.User.ID, "制服は個性を奪います。"); !errors.Is(err, ErrTimeLimit) {
+		t.Fatalf("late message: err = %v, want ErrTimeLimit", err)
+	}
+	messages, err := env.DB.GetSessionMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionMessages: %v", err)
+	}
+	if turns := dialogue(messages); len(turns) != 0 {
+		t.Fatalf("saved %d messages for a late message, want none", len(turns))
+	}
+
+	session, err = env.DB.GetDebateSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetDebateSession: %v", err)
+	}
+	if session.Passes != 1 {
+		t.Errorf("passes = %d, want 1", session.Passes)
+	}
+	if session.TurnDeadline == nil || !session.TurnDeadline.After(time.Now()) {
+		t.Fatalf("turn deadline = %v, want a new deadline", session.TurnDeadline)
+	}
+
+	resp, err := env.Service.ProcessUserMessage(ctx, session.ID, env.User.ID, "制服は個性を奪います。")
+	if err != nil {
+		t.Fatalf("message in the new turn: %v", err)
+	}
+	if resp.LLMMessage == nil {
+		t.Error("no reply to the message in the new turn")
+	}
+}
+
+// 時間切れのセッションの審査に失敗しても勝敗なしで終了させ、次の巡回で審査をやり直さない
+func TestSweepWithoutVerdict(t *testing.T) {
+	env := NewTestEnv(t, judgeDown{fakellm.NewScripted(nil)})
+	session := overdueSession(t, env, time.Hour)
+
+	env.Service.sweep(context.Background())
+
+	session, err := env.DB.GetDebateSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetDebateSession: %v", err)
+	}
+	if session.Status != "finished" || session.Winner != nil {
+		t.Fatalf("status = %q, winner = %v, want finished without a winner", session.Status, session.Winner)
+	}
+	if session.JudgeComment == nil || !strings.HasSuffix(*session.JudgeComment, textFor(session.Language).NoVerdict) {
+		t.Errorf("judge comment = %v, want the reason without a verdict", session.JudgeComment)
+	}
+
+	timed, err := env.DB.GetTimedSessions()
+	if err != nil {
+		t.Fatalf("GetTimedSessions: %v", err)
+	}
+	if len(timed) != 0 {
+		t.Errorf("%d sessions left for the sweeper, want none", len(timed))
+	}
+}
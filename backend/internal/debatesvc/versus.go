@@ -0,0 +1,190 @@
+package debatesvc
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/models"
+)
+
+// ユーザー同士のディベート（LLMは審査員のみ）
+// 作成したユーザーが"user1"、招待コードで参加したユーザーが"user2"として発言する
+const userVsUser = "user_vs_user"
+
+// セッションの参加者でないユーザーが発言しようとしたことを示す（APIでは403として扱う）
+var ErrNotParticipant = errors.New("not a participant of this debate")
+
+func validateMode(mode string) error {
+	switch mode {
+	case "user_vs_llm", "llm_vs_llm", userVsUser, teamMode:
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q (user_vs_llm, llm_vs_llm, user_vs_user or team)", mode)
+	}
+}
+
+// 人間の参加者の役割か
+func isHumanRole(session *models.DebateSession, role string) bool {
+	if p := participantByRole(session, role); p != nil {
+		return p.Kind == kindHuman
+	}
+	return role == "user" || role == "user1" || role == "user2"
+}
+
+// 参加者を招待するコード
+func newInviteCode() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// ユーザーがセッションで発言する役割（参加者でなければエラー）
+func participantRole(session *models.DebateSession, userID int64) (string, error) {
+	switch session.Mode {
+	case "user_vs_llm":
+		if session.UserID == nil || *session.UserID == userID {
+			return "user", nil
+		}
+	case userVsUser:
+		if session.UserID != nil && *session.UserID == userID {
+			return "user1", nil
+		}
+		if session.User2ID != nil && *session.User2ID == userID {
+			return "user2", nil
+		}
+	case teamMode:
+		if p := participantByUser(session, userID); p != nil {
+			return p.Role, nil
+		}
+	default:
+		return "", fmt.Errorf("%w: messages are not available in %s mode", ErrInvalidRequest, session.Mode)
+	}
+	return "", ErrNotParticipant
+}
+
+// ユーザーがセッションを進行（AIに発言させる・終了する）できるか確認する
+// LLM vs LLM では作成したユーザー、チーム戦では作成したユーザー（枠に入っていなくてもよい）と参加者、それ以外は参加者のみ
+func canControl(session *models.DebateSession, userID int64) error {
+	createdBy := session.CreatedBy != nil && *session.CreatedBy == userID
+	if session.Mode == "llm_vs_llm" {
+		if session.CreatedBy == nil || createdBy {
+			return nil
+		}
+		return ErrNotParticipant
+	}
+	if session.Mode == teamMode && createdBy {
+		return nil
+	}
+	_, err := participantRole(session, userID)
+	return err
+}
+
+// 賛成側と反対側の両方が1回以上発言したか
+// 相手が応答する前に終了して、自分の発言だけで審査させないために使う
+func bothSidesSpoke(session *models.DebateSession, messages []models.DebateMessage) bool {
+	spoke := map[string]bool{}
+	for _, msg := range dialogue(messages) {
+		if p := participantByRole(session, msg.Role); p != nil {
+			spoke[p.Side] = true
+			continue
+		}
+		switch msg.Role {
+		case "user1":
+			spoke[session.UserPosition] = true
+		case "user2":
+			spoke[session.User2Position] = true
+		}
+	}
+	return spoke["pro"] && spoke["con"]
+}
+
+// 招待コードでディベートに参加し、持ち時間の計測を始める
+// チーム戦ではside（空ならどちらでも）の空いている人間の枠に入り、すべての枠が埋まった時点で開始する
+func (s *Service) JoinDebate(ctx context.Context, userID int64, inviteCode, side string) (*models.DebateSession, error) {
+	if inviteCode == "" {
+		return nil, fmt.Errorf("%w: invite_code is required", ErrInvalidRequest)
+	}
+	session, err := s.database.GetDebateSessionByInviteCode(inviteCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown invite code", ErrInvalidRequest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if session.Mode == teamMode {
+		return s.joinTeam(session, userID, side)
+	}
+	if session.UserID != nil && *session.UserID == userID {
+		return nil, fmt.Errorf("%w: you cannot join your own debate", ErrInvalidRequest)
+	}
+
+	s.startClocks(session)
+	joined, err := s.database.JoinDebateSession(session.ID, userID, session.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join session: %w", err)
+	}
+	if !joined {
+		return nil, fmt.Errorf("%w: the debate has already started", ErrOutOfTurn)
+	}
+
+	session, err = s.database.GetDebateSession(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return session, nil
+}
+
+// user_vs_user の勝敗を両者のユーザー統計に反映（レーティングは対戦前の相手のレーティングで計算）
+func (s *Service) recordMatchResult(session *models.DebateSession, winner string) {
+	if session.UserID == nil || session.User2ID == nil {
+		return
+	}
+	stats1, err := s.database.GetUserStats(*session.UserID)
+	if err != nil {
+		log.Printf("Failed to get user stats: %v", err)
+		return
+	}
+	stats2, err := s.database.GetUserStats(*session.User2ID)
+	if err != nil {
+		log.Printf("Failed to get user stats: %v", err)
+		return
+	}
+
+	score := 0.5
+	switch winner {
+	case "user1":
+		score = 1
+	case "user2":
+		score = 0
+	}
+	rating1 := eloRating(stats1.Rating, stats2.Rating, score)
+	rating2 := eloRating(stats2.Rating, stats1.Rating, 1-score)
+	change1 := rating1 - stats1.Rating
+	change2 := rating2 - stats2.Rating
+	session.RatingChange = &change1
+	session.User2RatingChange = &change2
+	stats1.Rating = rating1
+	stats2.Rating = rating2
+
+	for _, stats := range []*models.UserStats{stats1, stats2} {
+		stats.TotalDebates++
+		switch {
+		case winner == "draw":
+			stats.Draws++
+		case (winner == "user1") == (stats == stats1):
+			stats.Wins++
+		default:
+			stats.Losses++
+		}
+		if err := s.database.UpdateUserStats(stats); err != nil {
+			log.Printf("Failed to update user stats: %v", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package fakellm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+)
+
+// カセットに記録される1回分のやり取り
+type Interaction struct {
+	Key        string        `json:"key"`
+	SchemaName string        `json:"schema_name,omitempty"`
+	Messages   []llm.Message `json:"messages"`
+	Content    string        `json:"content"`
+	Usage      llm.Usage     `json:"usage"`
+}
+
+// リクエスト内容からカセットの検索キーを計算
+func interactionKey(schemaName string, messages []llm.Message) string {
+	data, _ := json.Marshal(struct {
+		SchemaName string        `json:"schema_name"`
+		Messages   []llm.Message `json:"messages"`
+	}{schemaName, messages})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// やり取りを追記するカセットファイル（JSON Lines）
+// 複数のRecorderで1つのファイルを共有できる
+type Cassette struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenCassette(path string) (*Cassette, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	return &Cassette{file: file}, nil
+}
+
+func (c *Cassette) Close() error {
+	return c.file.Close()
+}
+
+// プロバイダをラップし、やり取りをこのカセットに記録する
+func (c *Cassette) Wrap(inner llm.Provider) *Recorder {
+	return &Recorder{inner: inner, cassette: c}
+}
+
+func (c *Cassette) append(interaction Interaction) error {
+	data, err := json.Marshal(interaction)
+	if err != nil {
+		return fmt.Errorf("failed to encode interaction: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// 実際のプロバイダとのやり取りをカセットに記録するデコレータ
+type Recorder struct {
+	inner    llm.Provider
+	cassette *Cassette
+}
+
+var _ llm.StreamProvider = (*Recorder)(nil)
+
+func (r *Recorder) ChatCompletion(ctx context.Context, messages []llm.Message, sampling llm.Sampling) (*llm.Response, error) {
+	response, err := r.inner.ChatCompletion(ctx, messages, sampling)
+	if err != nil {
+		return nil, err
+	}
+	r.record("", messages, response)
+	return response, nil
+}
+
+func (r *Recorder) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	response, err := r.inner.ChatCompletionWithSchema(ctx, messages, sampling, schema)
+	if err != nil {
+		return nil, err
+	}
+	r.record(schema.Name, messages, response)
+	return response, nil
+}
+
+// ストリーミングの応答は通常の補完と同じキーで記録する
+func (r *Recorder) ChatCompletionStream(ctx context.Context, messages []llm.Message, sampling llm.Sampling, onDelta func(delta string) error) (*llm.Response, error) {
+	streamer, ok := r.inner.(llm.StreamProvider)
+	if !ok {
+		response, err := r.ChatCompletion(ctx, messages, sampling)
+		if err != nil {
+			return nil, err
+		}
+		if err := onDelta(response.Content); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	response, err := streamer.ChatCompletionStream(ctx, messages, sampling, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	r.record("", messages, response)
+	return response, nil
+}
+
+// 記録に失敗しても応答はそのまま返す（記録漏れはログに残す）
+func (r *Recorder) record(schemaName string, messages []llm.Message, response *llm.Response) {
+	err := r.cassette.append(Interaction{
+		Key:        interactionKey(schemaName, messages),
+		SchemaName: schemaName,
+		Messages:   messages,
+		Content:    response.Content,
+		Usage:      response.Usage,
+	})
+	if err != nil {
+		log.Printf("Failed to record LLM interaction: %v", err)
+	}
+}
+
+// カセットに記録されたやり取りを再生するプロバイダ（サンプリングパラメータは使わない）
+// 同じリクエストが複数回記録されている場合は記録順に返し、使い切った後は最後の応答を返し続ける
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+	served       map[string]int
+}
+
+var _ llm.StreamProvider = (*Replayer)(nil)
+
+// カセットファイルを読み込んで再生用のプロバイダを作成
+func NewReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	replayer := &Replayer{
+		interactions: map[string][]Interaction{},
+		served:       map[string]int{},
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("invalid cassette line %d: %w", line, err)
+		}
+		replayer.interactions[interaction.Key] = append(replayer.interactions[interaction.Key], interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	return replayer, nil
+}
+
+func (p *Replayer) ChatCompletion(ctx context.Context, messages []llm.Message, sampling llm.Sampling) (*llm.Response, error) {
+	return p.replay("", messages)
+}
+
+func (p *Replayer) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	return p.replay(schema.Name, messages)
+}
+
+func (p *Replayer) ChatCompletionStream(ctx context.Context, messages []llm.Message, sampling llm.Sampling, onDelta func(delta string) error) (*llm.Response, error) {
+	response, err := p.replay("", messages)
+	if err != nil {
+		return nil, err
+	}
+	if err := streamContent(ctx, response.Content, onDelta); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (p *Replayer) replay(schemaName string, messages []llm.Message) (*llm.Response, error) {
+	key := interactionKey(schemaName, messages)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	recorded := p.interactions[key]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded interaction for request (schema=%q, messages=%d)", schemaName, len(messages))
+	}
+
+	index := min(p.served[key], len(recorded)-1)
+	p.served[key]++
+
+	interaction := recorded[index]
+	return &llm.Response{Content: interaction.Content, Usage: interaction.Usage}, nil
+}
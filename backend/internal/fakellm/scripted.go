@@ -0,0 +1,153 @@
+package fakellm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+)
+
+// 台本モードで使う既定の応答
+var defaultReplies = []string{
+	"私はこの立場を支持します。第一に、社会全体の利益につながるという点が重要です。具体的な事例を見ても、この方向性が多くの人にとって有益であることが示されています。",
+	"ご指摘の点は理解できますが、その主張には前提の飛躍があります。実際には例外的なケースも多く、一般化するには根拠が不足しているのではないでしょうか。",
+	"反論ありがとうございます。しかし長期的な影響を考えると、短期的なコストを上回るメリットがあると考えます。過去の類似した取り組みでも同様の結果が得られています。",
+	"その視点は重要ですが、実現可能性の観点が抜けています。制度や予算の制約を踏まえると、より現実的な代替案を検討すべきです。",
+}
+
+// 台本どおりの応答を返すオフライン用プロバイダ（サンプリングパラメータは使わない）
+// 通常の補完では用意された応答を順番に返し、構造化出力ではスキーマに適合したJSONを返す
+type Scripted struct {
+	mu         sync.Mutex
+	replies    []string
+	next       int
+	structured map[string]string
+}
+
+var _ llm.StreamProvider = (*Scripted)(nil)
+
+// 台本モードのプロバイダを作成（repliesが空の場合は既定の応答を使う）
+func NewScripted(replies []string) *Scripted {
+	if len(replies) == 0 {
+		replies = defaultReplies
+	}
+	return &Scripted{
+		replies:    replies,
+		structured: map[string]string{},
+	}
+}
+
+// 指定したスキーマ名の構造化出力として返すJSONを設定
+func (p *Scripted) SetStructured(schemaName, content string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.structured[schemaName] = content
+}
+
+func (p *Scripted) ChatCompletion(ctx context.Context, messages []llm.Message, sampling llm.Sampling) (*llm.Response, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("fake messages are empty")
+	}
+
+	p.mu.Lock()
+	reply := p.replies[p.next%len(p.replies)]
+	p.next++
+	p.mu.Unlock()
+
+	return &llm.Response{Content: reply, Usage: llm.Usage{Model: "fake"}}, nil
+}
+
+func (p *Scripted) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("fake messages are empty")
+	}
+
+	p.mu.Lock()
+	content, ok := p.structured[schema.Name]
+	p.mu.Unlock()
+
+	if !ok {
+		data, err := json.Marshal(sampleFromSchema(schema.Schema))
+		if err != nil {
+			return nil, err
+		}
+		content = string(data)
+	}
+
+	return &llm.Response{Content: content, Usage: llm.Usage{Model: "fake"}}, nil
+}
+
+func (p *Scripted) ChatCompletionStream(ctx context.Context, messages []llm.Message, sampling llm.Sampling, onDelta func(delta string) error) (*llm.Response, error) {
+	response, err := p.ChatCompletion(ctx, messages, sampling)
+	if err != nil {
+		return nil, err
+	}
+	if err := streamContent(ctx, response.Content, onDelta); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// JSONスキーマに適合するサンプル値を生成
+func sampleFromSchema(schema map[string]any) any {
+	if enum, ok := schema["enum"].([]string); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schema["type"] {
+	case "object":
+		properties, _ := schema["properties"].(map[string]any)
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		obj := make(map[string]any, len(properties))
+		for _, name := range names {
+			if prop, ok := properties[name].(map[string]any); ok {
+				obj[name] = sampleFromSchema(prop)
+			}
+		}
+		return obj
+	case "array":
+		if items, ok := schema["items"].(map[string]any); ok {
+			return []any{sampleFromSchema(items)}
+		}
+		return []any{}
+	case "integer":
+		return 50
+	case "number":
+		return 0.5
+	case "boolean":
+		return false
+	default:
+		if desc, ok := schema["description"].(string); ok && desc != "" {
+			return "（サンプル）" + desc
+		}
+		return "サンプル"
+	}
+}
+
+// 応答を数文字ずつの差分としてonDeltaへ渡す
+func streamContent(ctx context.Context, content string, onDelta func(delta string) error) error {
+	const chunkSize = 8
+
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(start+chunkSize, len(runes))
+		if err := onDelta(string(runes[start:end])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LLM呼び出しエラーの分類
+type ErrorKind string
+
+const (
+	ErrorUnknown       ErrorKind = "unknown"
+	ErrorRateLimit     ErrorKind = "rate_limit"     // レート制限（429）
+	ErrorTimeout       ErrorKind = "timeout"        // タイムアウト
+	ErrorContentFilter ErrorKind = "content_filter" // コンテンツフィルタによる拒否
+	ErrorAuth          ErrorKind = "auth"           // 認証・権限エラー
+	ErrorUnavailable   ErrorKind = "unavailable"    // 5xxやサーキットブレーカー作動中
+	ErrorInvalid       ErrorKind = "invalid"        // その他の不正なリクエスト（4xx）
+)
+
+// サーキットブレーカーが開いているため呼び出しを行わなかったことを示す
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// 分類済みのLLM呼び出しエラー
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int           // 上流のHTTPステータス（不明な場合は0）
+	RetryAfter time.Duration // 上流が指定した再試行までの待機時間
+	Usage      Usage         // 失敗した呼び出しでも消費したトークン使用量（スキーマ不適合など）
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("llm %s error (status %d): %v", e.Kind, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("llm %s error: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 再試行で回復する可能性があるかどうか
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrorRateLimit, ErrorTimeout, ErrorUnavailable:
+		return !errors.Is(e.Err, ErrCircuitOpen)
+	default:
+		return false
+	}
+}
+
+// 失敗した呼び出しで消費したトークン使用量（消費していなければ空）
+func UsageOf(err error) Usage {
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		return llmErr.Usage
+	}
+	return Usage{}
+}
+
+// エラーの分類を取得（分類されていないエラーはErrorUnknown）
+func KindOf(err error) ErrorKind {
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		return llmErr.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	return ErrorUnknown
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 構造化出力のJSONスキーマ
+type Schema struct {
+	Name   string
+	Schema map[string]any
+	// response_formatでスキーマを指定できない方式で、スキーマに従うよう指示するメッセージ
+	// （セッションの言語のテンプレートから作成する、空の場合はプロバイダの既定の指示）
+	Instruction string
+}
+
+// LLMの出力からJSON部分を取り出す（コードブロックや前後の説明文を取り除く）
+func ExtractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return content
+	}
+	end := strings.LastIndexAny(content, "}]")
+	if end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+// JSON文字列がスキーマに適合するか検証
+// 構造化出力で使うキーワード（type, properties, required, additionalProperties, items, enum）のみ対応
+func ValidateJSON(content string, schema map[string]any) error {
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return validateValue("$", value, schema)
+}
+
+func validateValue(path string, value any, schema map[string]any) error {
+	if enum := toStrings(schema["enum"]); enum != nil {
+		str, ok := value.(string)
+		if !ok || !contains(enum, str) {
+			return fmt.Errorf("%s: must be one of %v", path, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an object", path)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range toStrings(schema["required"]) {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := properties[name].(map[string]any)
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := validateValue(path+"."+name, v, prop); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an array", path)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, v := range arr {
+				if err := validateValue(fmt.Sprintf("%s[%d]", path, i), v, items); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: must be a string", path)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: must be a number", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", path)
+		}
+	}
+	return nil
+}
+
+func toStrings(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		strs := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
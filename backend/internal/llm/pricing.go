@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// モデルごとの料金（USD / 100万トークン）
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// モデル名から料金を引く料金表
+type PriceTable map[string]Price
+
+// 既定の料金表
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"gpt-4o-mini":  {Prompt: 0.15, Completion: 0.60},
+		"gpt-4o":       {Prompt: 2.50, Completion: 10.00},
+		"gpt-4.1":      {Prompt: 2.00, Completion: 8.00},
+		"gpt-4.1-mini": {Prompt: 0.40, Completion: 1.60},
+		"gpt-4.1-nano": {Prompt: 0.10, Completion: 0.40},
+		"o3-mini":      {Prompt: 1.10, Completion: 4.40},
+	}
+}
+
+// "model=prompt/completion,..." 形式の文字列を解析して料金表を作成
+// 例: "gpt-4o-mini=0.15/0.60,gpt-4o=2.50/10.00"
+func ParsePriceTable(spec string) (PriceTable, error) {
+	table := PriceTable{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		model, prices, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid price entry %q", entry)
+		}
+		promptStr, completionStr, ok := strings.Cut(prices, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid price entry %q", entry)
+		}
+
+		prompt, err := strconv.ParseFloat(strings.TrimSpace(promptStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt price for %q: %w", model, err)
+		}
+		completion, err := strconv.ParseFloat(strings.TrimSpace(completionStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid completion price for %q: %w", model, err)
+		}
+
+		table[strings.TrimSpace(model)] = Price{Prompt: prompt, Completion: completion}
+	}
+	return table, nil
+}
+
+// 別の料金表の内容で上書きした料金表を返す
+func (t PriceTable) Merge(overrides PriceTable) PriceTable {
+	merged := make(PriceTable, len(t)+len(overrides))
+	for model, price := range t {
+		merged[model] = price
+	}
+	for model, price := range overrides {
+		merged[model] = price
+	}
+	return merged
+}
+
+// モデルの料金を取得（完全一致がなければ最長の前方一致を使う）
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for name := range t {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
+
+// 使用量からコスト（USD）を計算
+func (t PriceTable) Cost(usage Usage) float64 {
+	price, ok := t.Lookup(usage.Model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1_000_000
+}
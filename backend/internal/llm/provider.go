@@ -0,0 +1,38 @@
+package llm
+
+import "context"
+
+// LLMに渡すチャットメッセージ
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLM呼び出しのトークン使用量
+type Usage struct {
+	Model            string `json:"model"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// LLMの応答
+type Response struct {
+	Content string
+	Usage   Usage
+}
+
+// チャット補完と構造化出力を提供するLLMバックエンド
+// samplingはリクエストに反映するサンプリングパラメータ（空の項目はモデルの既定値）
+type Provider interface {
+	// 通常のチャット補完（構造化出力なし）
+	ChatCompletion(ctx context.Context, messages []Message, sampling Sampling) (*Response, error)
+	// JSONスキーマに従った構造化出力のチャット補完
+	ChatCompletionWithSchema(ctx context.Context, messages []Message, sampling Sampling, schema Schema) (*Response, error)
+}
+
+// ストリーミング補完に対応したLLMバックエンド
+type StreamProvider interface {
+	Provider
+	// 応答を差分ごとにonDeltaへ渡しながら生成し、最終的な全文を返す
+	ChatCompletionStream(ctx context.Context, messages []Message, sampling Sampling, onDelta func(delta string) error) (*Response, error)
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 指定したモデルを使うプロバイダを作成する関数
+type Factory func(model string) (Provider, error)
+
+// 名前付きのプロバイダをモデルごとに作成・キャッシュするレジストリ
+type Registry struct {
+	mu              sync.Mutex
+	factories       map[string]Factory
+	instances       map[string]Provider
+	allowedModels   map[string]bool
+	defaultProvider string
+	defaultModel    string
+}
+
+func NewRegistry(defaultProvider, defaultModel string) *Registry {
+	return &Registry{
+		factories:       map[string]Factory{},
+		instances:       map[string]Provider{},
+		defaultProvider: defaultProvider,
+		defaultModel:    defaultModel,
+	}
+}
+
+// プロバイダを登録
+func (r *Registry) Register(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// 既定のモデル以外に利用できるモデルを設定
+// 許可していないモデルはクライアントを作らずに拒否する（モデルごとにクライアントをキャッシュするため）
+func (r *Registry) SetAllowedModels(models []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.allowedModels = map[string]bool{}
+	for _, model := range models {
+		if model = strings.TrimSpace(model); model != "" {
+			r.allowedModels[model] = true
+		}
+	}
+}
+
+// 空の指定を既定値で補完したプロバイダ名とモデル名を返す
+func (r *Registry) Resolve(provider, model string) (string, string, error) {
+	provider = strings.TrimSpace(provider)
+	model = strings.TrimSpace(model)
+	if provider == "" {
+		provider = r.defaultProvider
+	}
+	if model == "" {
+		model = r.defaultModel
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.factories[provider]; !ok {
+		return "", "", fmt.Errorf("unknown provider %q (available: %s)", provider, strings.Join(r.providerNames(), ", "))
+	}
+	if model != r.defaultModel && !r.allowedModels[model] {
+		return "", "", fmt.Errorf("model %q is not allowed", model)
+	}
+	return provider, model, nil
+}
+
+// プロバイダとモデルに対応するプロバイダを取得（空の場合は既定値）
+func (r *Registry) Get(provider, model string) (Provider, error) {
+	provider, model, err := r.Resolve(provider, model)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := provider + "/" + model
+	if instance, ok := r.instances[key]; ok {
+		return instance, nil
+	}
+
+	instance, err := r.factories[provider](model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider %s: %w", key, err)
+	}
+	r.instances[key] = instance
+	return instance, nil
+}
+
+// 既定のプロバイダ
+func (r *Registry) Default() (Provider, error) {
+	return r.Get("", "")
+}
+
+func (r *Registry) providerNames() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 再試行とサーキットブレーカーの設定
+type RetryPolicy struct {
+	MaxRetries       int           // 初回を除く最大再試行回数
+	BaseDelay        time.Duration // バックオフの初期待機時間
+	MaxDelay         time.Duration // バックオフの最大待機時間（Retry-Afterもこの値で打ち切る）
+	BreakerThreshold int           // ブレーカーを開く連続失敗回数（0以下で無効）
+	BreakerCooldown  time.Duration // ブレーカーを開いてから試行を再開するまでの時間
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:       3,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         20 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// 一時的なエラーを再試行し、上流の障害時にはサーキットブレーカーで即座に失敗させるデコレータ
+// ブレーカーはラップしたプロバイダ（＝モデル）ごとに1つ持つ
+type Resilient struct {
+	inner   Provider
+	name    string
+	policy  RetryPolicy
+	breaker *circuitBreaker
+	sleep   func(ctx context.Context, d time.Duration) error // 再試行までの待機（テストで置き換える）
+}
+
+var _ StreamProvider = (*Resilient)(nil)
+
+// nameはログとエラーメッセージに使うモデル名
+func NewResilient(inner Provider, name string, policy RetryPolicy) *Resilient {
+	return &Resilient{
+		inner:   inner,
+		name:    name,
+		policy:  policy,
+		breaker: &circuitBreaker{threshold: policy.BreakerThreshold, cooldown: policy.BreakerCooldown, now: time.Now},
+		sleep:   sleep,
+	}
+}
+
+// dだけ待機する（待機中にキャンセルされた場合はctxのエラー）
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *Resilient) ChatCompletion(ctx context.Context, messages []Message, sampling Sampling) (*Response, error) {
+	return r.do(ctx, func() (*Response, error) {
+		return r.inner.ChatCompletion(ctx, messages, sampling)
+	})
+}
+
+func (r *Resilient) ChatCompletionWithSchema(ctx context.Context, messages []Message, sampling Sampling, schema Schema) (*Response, error) {
+	return r.do(ctx, func() (*Response, error) {
+		return r.inner.ChatCompletionWithSchema(ctx, messages, sampling, schema)
+	})
+}
+
+// 差分を送信し始めた後は再試行すると内容が重複するため、最初の差分が届く前の失敗のみ再試行する
+func (r *Resilient) ChatCompletionStream(ctx context.Context, messages []Message, sampling Sampling, onDelta func(delta string) error) (*Response, error) {
+	streamer, ok := r.inner.(StreamProvider)
+	if !ok {
+		response, err := r.ChatCompletion(ctx, messages, sampling)
+		if err != nil {
+			return nil, err
+		}
+		if err := onDelta(response.Content); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	started := false
+	return r.do(ctx, func() (*Response, error) {
+		response, err := streamer.ChatCompletionStream(ctx, messages, sampling, func(delta string) error {
+			started = true
+			return onDelta(delta)
+		})
+		if err != nil && started {
+			return nil, &permanentError{err}
+		}
+		return response, err
+	})
+}
+
+func (r *Resilient) do(ctx context.Context, call func() (*Response, error)) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		if !r.breaker.allow() {
+			log.Printf("[LLM] circuit open model=%s", r.name)
+			return nil, &Error{Kind: ErrorUnavailable, Err: ErrCircuitOpen}
+		}
+
+		response, err := call()
+		// 呼び出し元のキャンセルやタイムアウトは上流の障害ではないため、失敗として数えない
+		if err != nil && ctx.Err() != nil {
+			r.breaker.release()
+		} else {
+			r.breaker.record(err)
+		}
+		if err == nil {
+			return response, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return nil, permanent.err
+		}
+
+		var llmErr *Error
+		if !errors.As(err, &llmErr) {
+			return nil, err
+		}
+
+		// 呼び出し元がキャンセルした場合や、再試行しても回復しないエラーはそのまま返す
+		if ctx.Err() != nil || !llmErr.Retryable() || attempt >= r.policy.MaxRetries {
+			return nil, err
+		}
+
+		delay := r.backoff(attempt, llmErr.RetryAfter)
+		log.Printf("[LLM] retrying model=%s attempt=%d kind=%s delay=%s", r.name, attempt+1, llmErr.Kind, delay)
+
+		if r.sleep(ctx, delay) != nil {
+			return nil, err
+		}
+	}
+}
+
+// Retry-Afterが指定されていればそれに従い、なければジッター付き指数バックオフで待機時間を決める
+func (r *Resilient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, r.policy.MaxDelay)
+	}
+
+	delay := r.policy.BaseDelay << attempt
+	if delay <= 0 || delay > r.policy.MaxDelay {
+		delay = r.policy.MaxDelay
+	}
+	// 待機時間の半分〜全量の範囲でランダム化
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// 再試行してはいけないエラー
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// 連続失敗回数に基づくサーキットブレーカー
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// 呼び出してよいかどうか（クールダウン後は1件だけ試行を許可する）
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// 呼び出し結果を記録（上流の障害を示すエラーのみ失敗として数える）
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	switch KindOf(err) {
+	case ErrorUnavailable, ErrorTimeout:
+		b.failures++
+		if b.threshold > 0 && b.failures >= b.threshold {
+			b.openUntil = b.now().Add(b.cooldown)
+		}
+	default:
+		if err == nil {
+			b.failures = 0
+		}
+	}
+}
+
+// 結果を記録せずに試行を終える（試行中のプローブは次の呼び出しに譲る）
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
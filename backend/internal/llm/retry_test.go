@@ -0,0 +1,194 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 用意したエラーを順に返し、尽きたら成功するプロバイダ
+type failingProvider struct {
+	errs  []error
+	calls int
+	// 呼び出し中に実行する処理（呼び出し元のキャンセルの再現用）
+	during func()
+}
+
+func (p *failingProvider) ChatCompletion(ctx context.Context, messages []Message, sampling Sampling) (*Response, error) {
+	p.calls++
+	if p.during != nil {
+		p.during()
+	}
+	if len(p.errs) == 0 {
+		return &Response{Content: "ok"}, nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return nil, err
+}
+
+func (p *failingProvider) ChatCompletionWithSchema(ctx context.Context, messages []Message, sampling Sampling, schema Schema) (*Response, error) {
+	return p.ChatCompletion(ctx, messages, sampling)
+}
+
+// 待機せずに待機時間を記録し、時計を手動で進めるテスト用のResilient
+type testResilient struct {
+	*Resilient
+	delays []time.Duration
+	clock  time.Time
+}
+
+func newTestResilient(inner Provider, policy RetryPolicy) *testResilient {
+	t := &testResilient{Resilient: NewResilient(inner, "test-model", policy), clock: time.Unix(0, 0)}
+	t.sleep = func(ctx context.Context, d time.Duration) error {
+		t.delays = append(t.delays, d)
+		return ctx.Err()
+	}
+	t.breaker.now = func() time.Time { return t.clock }
+	return t
+}
+
+func unavailable() error {
+	return &Error{Kind: ErrorUnavailable, StatusCode: 503, Err: errors.New("service unavailable")}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	inner := &failingProvider{errs: []error{unavailable(), unavailable()}}
+	r := newTestResilient(inner, RetryPolicy{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+
+	response, err := r.ChatCompletion(context.Background(), nil, Sampling{})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if response.Content != "ok" || inner.calls != 3 {
+		t.Fatalf("got %q after %d calls, want ok after 3", response.Content, inner.calls)
+	}
+
+	// ジッターは待機時間の半分〜全量の範囲
+	for i, d := range r.delays {
+		base := 100 * time.Millisecond << i
+		if d < base/2 || d > base {
+			t.Errorf("delay %d = %s, want between %s and %s", i+1, d, base/2, base)
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name  string
+		errs  []error
+		calls int
+	}{
+		{"max retries", []error{unavailable(), unavailable(), unavailable()}, 3},
+		{"not retryable", []error{&Error{Kind: ErrorInvalid, StatusCode: 400, Err: errors.New("bad request")}}, 1},
+		{"unclassified", []error{errors.New("boom")}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &failingProvider{errs: tt.errs}
+			r := newTestResilient(inner, RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+
+			if _, err := r.ChatCompletion(context.Background(), nil, Sampling{}); err == nil {
+				t.Fatal("ChatCompletion succeeded, want error")
+			}
+			if inner.calls != tt.calls {
+				t.Errorf("calls = %d, want %d", inner.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{"honored", 3 * time.Second, 3 * time.Second},
+		{"capped by max delay", time.Minute, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &failingProvider{errs: []error{&Error{Kind: ErrorRateLimit, StatusCode: 429, RetryAfter: tt.retryAfter, Err: errors.New("rate limited")}}}
+			r := newTestResilient(inner, RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Second})
+
+			if _, err := r.ChatCompletion(context.Background(), nil, Sampling{}); err != nil {
+				t.Fatalf("ChatCompletion: %v", err)
+			}
+			if len(r.delays) != 1 || r.delays[0] != tt.want {
+				t.Errorf("delays = %v, want [%s]", r.delays, tt.want)
+			}
+		})
+	}
+}
+
+// 閉 → 開 → クールダウン後の1件の試行（半開）→ 成功で閉じる
+func TestCircuitBreakerStates(t *testing.T) {
+	inner := &failingProvider{errs: []error{unavailable(), unavailable(), unavailable()}}
+	r := newTestResilient(inner, RetryPolicy{BreakerThreshold: 2, BreakerCooldown: 30 * time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.ChatCompletion(ctx, nil, Sampling{}); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: circuit opened before the threshold", i+1)
+		}
+	}
+
+	// 開いている間は上流を呼ばずに失敗する
+	if _, err := r.ChatCompletion(ctx, nil, Sampling{}); !errors.Is(err, ErrCircuitOpen) || KindOf(err) != ErrorUnavailable {
+		t.Fatalf("err = %v, want open circuit", err)
+	}
+	if inner.calls != 2 {
+		t.Fatalf("calls = %d while open, want 2", inner.calls)
+	}
+
+	// クールダウン後の試行が失敗すると再び開く
+	r.clock = r.clock.Add(31 * time.Second)
+	if _, err := r.ChatCompletion(ctx, nil, Sampling{}); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("probe after cooldown was rejected")
+	}
+	if _, err := r.ChatCompletion(ctx, nil, Sampling{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v after failed probe, want open circuit", err)
+	}
+
+	// 試行中は他の呼び出しを通さない
+	r.clock = r.clock.Add(31 * time.Second)
+	inner.during = func() {
+		inner.during = nil
+		if r.breaker.allow() {
+			t.Error("second call was allowed during the probe")
+		}
+	}
+	if _, err := r.ChatCompletion(ctx, nil, Sampling{}); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	// 試行が成功すると閉じる
+	for i := 0; i < 2; i++ {
+		if _, err := r.ChatCompletion(ctx, nil, Sampling{}); err != nil {
+			t.Fatalf("call %d after recovery: %v", i+1, err)
+		}
+	}
+}
+
+// 呼び出し元のタイムアウトやキャンセルは上流の障害として数えない
+func TestCircuitBreakerIgnoresCallerTimeout(t *testing.T) {
+	inner := &failingProvider{}
+	r := newTestResilient(inner, RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second, BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	inner.errs = []error{&Error{Kind: ErrorTimeout, Err: context.DeadlineExceeded}}
+	inner.during = cancel
+	if _, err := r.ChatCompletion(ctx, nil, Sampling{}); KindOf(err) != ErrorTimeout {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("calls = %d after caller timeout, want 1", inner.calls)
+	}
+
+	inner.during = nil
+	if _, err := r.ChatCompletion(context.Background(), nil, Sampling{}); err != nil {
+		t.Fatalf("circuit opened by caller timeout: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// サンプリングパラメータ（nilの項目はモデルの既定値を使う）
+type Sampling struct {
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   *int64
+	Seed        *int64
+}
+
+// 別のパラメータで指定された項目を上書きしたパラメータを返す
+func (s Sampling) Merge(override Sampling) Sampling {
+	if override.Temperature != nil {
+		s.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		s.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		s.MaxTokens = override.MaxTokens
+	}
+	if override.Seed != nil {
+		s.Seed = override.Seed
+	}
+	return s
+}
+
+// パラメータが有効な範囲にあるか検証
+func (s Sampling) Validate() error {
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if s.TopP != nil && (*s.TopP <= 0 || *s.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if s.MaxTokens != nil && *s.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive")
+	}
+	return nil
+}
+
+// "key=value,..." 形式の文字列を解析してサンプリングパラメータを作成
+// 例: "temperature=0.2,top_p=1,max_tokens=800,seed=42"
+func ParseSampling(spec string) (Sampling, error) {
+	var s Sampling
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return Sampling{}, fmt.Errorf("invalid sampling entry %q", entry)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "temperature", "top_p":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			if key == "temperature" {
+				s.Temperature = &f
+			} else {
+				s.TopP = &f
+			}
+		case "max_tokens", "seed":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			if key == "max_tokens" {
+				s.MaxTokens = &n
+			} else {
+				s.Seed = &n
+			}
+		default:
+			return Sampling{}, fmt.Errorf("unknown sampling parameter %q", key)
+		}
+	}
+	return s, s.Validate()
+}
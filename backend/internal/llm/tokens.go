@@ -0,0 +1,29 @@
+package llm
+
+import "unicode/utf8"
+
+// 1メッセージあたりのロールや区切りのオーバーヘッド
+const messageOverheadTokens = 4
+
+// テキストのトークン数を概算
+// ASCII文字は約4文字で1トークン、日本語などのマルチバイト文字は1文字1トークンとして数える
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// メッセージ列全体のトークン数を概算
+func EstimateMessagesTokens(messages []Message) int {
+	total := 0
+	for _, m := range messages {
+		total += EstimateTokens(m.Content) + messageOverheadTokens
+	}
+	return total
+}
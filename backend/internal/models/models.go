@@ -13,27 +13,227 @@ type User struct {
 // ディベートセッション
 type DebateSession struct {
 	ID           int64      `json:"id"`
-	UserID       *int64     `json:"user_id,omitempty"`       // ユーザー vs LLM の場合のみ
+	UserID       *int64     `json:"user_id,omitempty"`       // ユーザーが参加するモードで作成したユーザー（LLM vs LLM では空）
+	CreatedBy    *int64     `json:"-"`                       // セッションを作成したユーザー（LLM使用量の集計用、全モード）
 	Topic        string     `json:"topic"`                   // ディベートのテーマ
 	UserPosition string     `json:"user_position,omitempty"` // ユーザーの立場（pro/con）
 	LLMPosition  string     `json:"llm_position,omitempty"`  // LLMの立場（pro/con）
 	LLM1Position string     `json:"llm1_position,omitempty"` // LLM vs LLM の場合
 	LLM2Position string     `json:"llm2_position,omitempty"` // LLM vs LLM の場合
-	Mode         string     `json:"mode"`                    // "user_vs_llm" or "llm_vs_llm"
-	Status       string     `json:"status"`                  // "ongoing", "finished"
-	Winner       *string    `json:"winner,omitempty"`        // "user", "llm", "llm1", "llm2", "draw"
+	Mode         string     `json:"mode"`                    // "user_vs_llm", "llm_vs_llm", "user_vs_user" or "team"
+	Status       string     `json:"status"`                  // "waiting"（参加者の招待中）, "ongoing", "finished"
+	Winner       *string    `json:"winner,omitempty"`        // "user", "llm", "llm1", "llm2", "user1", "user2", "draw"（team は "pro", "con"）
 	JudgeComment *string    `json:"judge_comment,omitempty"` // 審査員のコメント
 	CreatedAt    time.Time  `json:"created_at"`
 	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+
+	// user_vs_user で招待コードから参加したユーザー（"user2"）と、その立場・終了時のレーティングの変動
+	// 作成したユーザー（"user1"）の立場はUserPosition、レーティングの変動はRatingChange
+	User2ID           *int64   `json:"user2_id,omitempty"`
+	User2Position     string   `json:"user2_position,omitempty"`
+	User2RatingChange *float64 `json:"user2_rating_change,omitempty"`
+	InviteCode        string   `json:"-"` // 参加者を招待するコード（user_vs_user / team、作成時のレスポンスでのみ返す）
+
+	Participants []Participant `json:"participants,omitempty"` // チーム戦の参加者（team のみ）
+
+	// 役割ごとのLLMプロバイダとモデル（LLM1/LLM2は LLM vs LLM の場合のみ）
+	LLM1Provider  string `json:"llm1_provider,omitempty"`
+	LLM1Model     string `json:"llm1_model,omitempty"`
+	LLM2Provider  string `json:"llm2_provider,omitempty"`
+	LLM2Model     string `json:"llm2_model,omitempty"`
+	JudgeProvider string `json:"judge_provider,omitempty"`
+	JudgeModel    string `json:"judge_model,omitempty"`
+
+	StructuredTurns bool `json:"structured_turns"` // LLMの発言を主張・要点・反論の構造化形式で生成する
+
+	MinRounds int    `json:"min_rounds,omitempty"` // LLM vs LLM で司会者が終了を判断し始めるラウンド数（0の場合はサーバー設定）
+	MaxRounds int    `json:"max_rounds,omitempty"` // LLM vs LLM の最大ラウンド数（0の場合はサーバー設定）
+	EndReason string `json:"end_reason,omitempty"` // 司会者が議論を打ち切った理由
+
+	Language string `json:"language"`          // ディベートの言語（"ja", "en"）
+	Persona  string `json:"persona,omitempty"` // AI討論者のペルソナ（user_vs_llm のみ、空の場合は標準の討論者）
+
+	// user_vs_llm の難易度（"easy", "normal", "hard", "expert"）と、難易度に応じて選んだAI討論者のモデル
+	Difficulty  string `json:"difficulty,omitempty"`
+	LLMProvider string `json:"llm_provider,omitempty"`
+	LLMModel    string `json:"llm_model,omitempty"`
+	// 終了時のユーザーのレーティングの変動（user_vs_llm のみ）
+	RatingChange *float64 `json:"rating_change,omitempty"`
+
+	// ディベート形式とフェーズの進行状況（形式が"free"の場合は自由な応酬でフェーズはない）
+	Format       string `json:"format"`
+	CurrentPhase string `json:"current_phase,omitempty"` // 現在のフェーズ名（全フェーズ終了後は空）
+	TurnIndex    int    `json:"turn_index"`              // 形式の発言順のうち終わった発言数
+
+	// 審査員パネル（空の場合はJudgeProvider/JudgeModelの1人で審査）と判定の集計方法
+	JudgePanel       []JudgeSpec `json:"judge_panel,omitempty"`
+	JudgeAggregation string      `json:"judge_aggregation,omitempty"` // "majority" or "average"
+
+	// 立場と発言順を入れ替えて再審査し、判定が食い違った場合（位置バイアス）は引き分けとする
+	BiasCheck    bool  `json:"bias_check"`
+	PositionBias *bool `json:"position_bias,omitempty"` // 確認した場合のみ、判定が食い違ったらtrue
+
+	FactCheck bool `json:"fact_check"` // 発言ごとに事実についての主張を確認するか
+
+	// コーチのヒントを使える回数と使った回数（user_vs_llm のみ）
+	HintBudget int `json:"hint_budget"`
+	HintsUsed  int `json:"hints_used"`
+
+	// 持ち時間（秒、0は制限なし）。1回の発言の持ち時間は user_vs_llm のユーザーの番のみ
+	TurnSeconds  int        `json:"turn_seconds"`
+	TotalSeconds int        `json:"total_seconds"`
+	Deadline     *time.Time `json:"deadline,omitempty"`      // ディベート全体の期限
+	TurnDeadline *time.Time `json:"turn_deadline,omitempty"` // ユーザーの現在の番の期限（ユーザーの番でなければ空）
+	Passes       int        `json:"passes"`                  // 持ち時間を過ぎて受け付けなかったユーザーの発言の数
+
+	// 役割ごとのサンプリングパラメータ（サーバーの既定値にリクエストの指定を反映したもの）
+	DebaterSampling *SamplingParams `json:"debater_sampling,omitempty"`
+	JudgeSampling   *SamplingParams `json:"judge_sampling,omitempty"`
+	TopicSampling   *SamplingParams `json:"topic_sampling,omitempty"`
+}
+
+// チーム戦の参加者（各チームの発言者は発言順に交代で発言する）
+type Participant struct {
+	ID           int64    `json:"id"`
+	SessionID    int64    `json:"session_id"`
+	Role         string   `json:"role"`          // メッセージの役割（"pro1", "con2" など）
+	Side         string   `json:"side"`          // "pro" / "con"
+	SpeakerOrder int      `json:"speaker_order"` // チーム内の発言順（1から）
+	Kind         string   `json:"kind"`          // "human" / "ai"
+	UserID       *int64   `json:"user_id,omitempty"`
+	Provider     string   `json:"provider,omitempty"` // AIの場合のみ
+	Model        string   `json:"model,omitempty"`
+	RatingChange *float64 `json:"rating_change,omitempty"` // 終了時のレーティングの変動（人間のみ）
+}
+
+// セッション作成時に指定するチーム戦の参加者（同じ側の中では指定した順に発言する）
+type ParticipantSpec struct {
+	Side     string `json:"side"`               // "pro" / "con"
+	Kind     string `json:"kind"`               // "human" / "ai"
+	Provider string `json:"provider,omitempty"` // AIの場合のみ、空の場合はサーバーの既定値
+	Model    string `json:"model,omitempty"`
+}
+
+// 審査員パネルの1人
+type JudgeSpec struct {
+	Provider string `json:"provider,omitempty"` // 空の場合はサーバーの既定値
+	Model    string `json:"model,omitempty"`
+	Persona  string `json:"persona,omitempty"` // 審査の観点（judge_personasテンプレートのブロック名、空の場合は観点の指定なし）
+}
+
+// LLMのサンプリングパラメータ（省略した項目はモデルの既定値）
+type SamplingParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   *int64   `json:"max_tokens,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
 }
 
 // ディベートメッセージ
 type DebateMessage struct {
 	ID        int64     `json:"id"`
 	SessionID int64     `json:"session_id"`
-	Role      string    `json:"role"` // "user", "llm", "llm1", "llm2", "judge", "system"
+	Role      string    `json:"role"` // "user", "llm", "llm1", "llm2", "user1", "user2", "system"（team は参加者の役割）
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// 構造化モードで生成された発言の要点と反論
+	KeyPoints    []string `json:"key_points,omitempty"`
+	Counterpoint string   `json:"counterpoint,omitempty"`
+
+	PromptVersion string `json:"prompt_version,omitempty"` // LLMが生成したメッセージの場合、使用したプロンプトのバージョン
+	Phase         string `json:"phase,omitempty"`          // 発言したフェーズ名（フェーズのある形式のみ）
+	ParticipantID *int64 `json:"participant_id,omitempty"` // 発言した参加者（team のみ）
+
+	FactChecks []FactCheck `json:"fact_checks,omitempty"` // ファクトチェックの結果（確認した主張がある場合のみ）
+}
+
+// 発言に含まれる確認可能な主張と、その確からしさの評価
+type FactCheck struct {
+	ID            int64     `json:"id"`
+	SessionID     int64     `json:"session_id"`
+	MessageID     int64     `json:"message_id"`
+	Claim         string    `json:"claim"`
+	Rating        string    `json:"rating"` // "plausible", "dubious", "unverifiable"
+	Note          string    `json:"note"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ファクトチェックのLLMの応答
+type FactCheckResponse struct {
+	Claims []FactCheck `json:"claims"`
+}
+
+// ディベート形式（フェーズの順序と各フェーズの発言順）
+type DebateFormat struct {
+	Name   string        `json:"name"`
+	Phases []DebatePhase `json:"phases"` // 空の場合は自由な応酬
+}
+
+// ディベートのフェーズ
+type DebatePhase struct {
+	Name        string   `json:"name"`                  // "opening", "rebuttal" など
+	Title       string   `json:"title,omitempty"`       // 表示名（空の場合はプロンプトテンプレートの定義）
+	Speakers    []string `json:"speakers"`              // 発言する側の順序（"pro" / "con"）
+	MaxChars    int      `json:"max_chars,omitempty"`   // 1回の発言の最大文字数（0の場合は制限なし）
+	Instruction string   `json:"instruction,omitempty"` // 発言者への指示（空の場合はプロンプトテンプレートの定義）
+}
+
+// フェーズのある形式とチーム戦での進行状況
+type PhaseStatus struct {
+	Format      string `json:"format"`
+	Phase       string `json:"phase,omitempty"`        // 現在のフェーズ（全フェーズ終了後は空）
+	MaxChars    int    `json:"max_chars,omitempty"`    // 現在のフェーズの最大文字数
+	NextSpeaker string `json:"next_speaker,omitempty"` // 次に発言する役割（"user", "llm", "llm1", "llm2", "user1", "user2"、team は参加者の役割）
+	Completed   bool   `json:"completed"`              // すべてのフェーズが終わった
+}
+
+// 長いディベートの古い発言をまとめた要約（セッションごとにキャッシュ）
+type SessionSummary struct {
+	SessionID        int64     `json:"session_id"`
+	ThroughMessageID int64     `json:"through_message_id"` // このIDまでの発言を要約済み
+	Content          string    `json:"content"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// 保存された審査結果（集計した判定、または審査員パネルの審査員ごとの判定）
+type JudgeResult struct {
+	ID            int64  `json:"id"`
+	SessionID     int64  `json:"session_id"`
+	Kind          string `json:"kind"` // "verdict"（集計した判定） or "ballot"（審査員ごとの判定）
+	JudgeProvider string `json:"judge_provider,omitempty"`
+	JudgeModel    string `json:"judge_model,omitempty"`
+	Persona       string `json:"persona,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	Swapped       bool   `json:"swapped,omitempty"`    // 立場と発言順を入れ替えて審査した判定（元の立場に戻して保存）
+	HintsUsed     int    `json:"hints_used,omitempty"` // 判定時にユーザーが使っていたコーチのヒントの回数（verdictのみ）
+	JudgeResponse
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AI討論者のペルソナと戦績（user_vs_llm でのAIから見た勝敗）
+type PersonaInfo struct {
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+}
+
+// 位置バイアスの確認結果の集計
+type BiasStats struct {
+	Checked      int                  `json:"checked"` // 確認したディベート数
+	Biased       int                  `json:"biased"`  // 入れ替えた審査で判定が食い違ったディベート数
+	Rate         float64              `json:"rate"`
+	ByJudgeModel map[string]BiasCount `json:"by_judge_model"`
+}
+
+// 審査員のモデルごとの位置バイアスの集計（パネルの審査員ごとに数える）
+type BiasCount struct {
+	Checked int     `json:"checked"` // 入れ替えた審査もできた審査員の判定数
+	Biased  int     `json:"biased"`  // そのうち入れ替えた審査で判定が食い違った数
+	Rate    float64 `json:"rate"`
 }
 
 // ユーザー統計
@@ -44,6 +244,30 @@ type UserStats struct {
 	Losses       int     `json:"losses"`
 	Draws        int     `json:"draws"`
 	WinRate      float64 `json:"win_rate"`
+	Rating       float64 `json:"rating"`        // 対戦したAIの難易度で重み付けしたレーティング（初期値1200）
+	AssistedWins int     `json:"assisted_wins"` // 勝利のうちコーチのヒントを使ったもの
+}
+
+// トークン使用量とコスト
+type TokenUsage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // USD
+}
+
+// セッション単位の使用量集計
+type SessionUsage struct {
+	Total  TokenUsage            `json:"total"`
+	ByRole map[string]TokenUsage `json:"by_role"` // "llm", "llm1", "llm2", "judge", "topic"
+}
+
+// ユーザー単位の使用量集計
+type UserUsage struct {
+	UserID int64                 `json:"user_id"`
+	Total  TokenUsage            `json:"total"`
+	ByMode map[string]TokenUsage `json:"by_mode"` // "user_vs_llm", "llm_vs_llm"
 }
 
 // ディベートテーマ生成のレスポンス（構造化出力用）
@@ -73,6 +297,21 @@ type JudgeResponse struct {
 	FinalComment  string   `json:"final_comment"`
 }
 
+// ディベート継続判定のレスポンス（構造化出力用）
+type DebateContinueResponse struct {
+	ShouldContinue bool   `json:"should_continue"`
+	Reason         string `json:"reason"`
+}
+
+// 審査員1人の判定（失敗した場合はErrorのみ）
+type JudgeBallot struct {
+	Judge         JudgeSpec      `json:"judge"`
+	PromptVersion string         `json:"prompt_version,omitempty"`
+	Swapped       bool           `json:"swapped,omitempty"` // 立場と発言順を入れ替えて審査した判定（Resultは元の立場に戻したもの）
+	Result        *JudgeResponse `json:"result,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
 type Score struct {
 	Pro int `json:"pro"`
 	Con int `json:"con"`
@@ -95,16 +334,61 @@ type LoginResponse struct {
 }
 
 type CreateDebateRequest struct {
-	Mode              string `json:"mode"`                    // "user_vs_llm" or "llm_vs_llm"
+	Mode              string `json:"mode"`                    // "user_vs_llm", "llm_vs_llm", "user_vs_user" or "team"
 	Topic             string `json:"topic,omitempty"`         // 空の場合はLLMがランダム生成
 	UserPosition      string `json:"user_position,omitempty"` // "pro", "con", "random"
 	RandomizeTopic    bool   `json:"randomize_topic"`
 	RandomizePosition bool   `json:"randomize_position"`
+
+	// 役割ごとのLLMプロバイダとモデル（空の場合はサーバーの既定値）
+	LLM1Provider  string `json:"llm1_provider,omitempty"`
+	LLM1Model     string `json:"llm1_model,omitempty"`
+	LLM2Provider  string `json:"llm2_provider,omitempty"`
+	LLM2Model     string `json:"llm2_model,omitempty"`
+	JudgeProvider string `json:"judge_provider,omitempty"`
+	JudgeModel    string `json:"judge_model,omitempty"`
+
+	StructuredTurns bool `json:"structured_turns"` // LLMの発言を構造化形式（主張・要点・反論）で生成する
+
+	MinRounds int `json:"min_rounds,omitempty"` // LLM vs LLM の最小ラウンド数（0の場合はサーバー設定）
+	MaxRounds int `json:"max_rounds,omitempty"` // LLM vs LLM の最大ラウンド数（0の場合はサーバー設定）
+
+	Language string `json:"language,omitempty"` // ディベートの言語（"ja", "en"、空の場合は"ja"）
+	Format   string `json:"format,omitempty"`   // ディベート形式（空の場合は"free"）
+	Persona  string `json:"persona,omitempty"`  // AI討論者のペルソナ（user_vs_llm のみ）
+
+	Difficulty string `json:"difficulty,omitempty"` // user_vs_llm の難易度（空の場合は"normal"）
+
+	// 役割ごとのサンプリングパラメータ（指定した項目のみサーバーの既定値を上書き）
+	DebaterSampling *SamplingParams `json:"debater_sampling,omitempty"` // llm / llm1 / llm2
+	JudgeSampling   *SamplingParams `json:"judge_sampling,omitempty"`   // 審査員・司会者・要約
+	TopicSampling   *SamplingParams `json:"topic_sampling,omitempty"`   // テーマ生成
+
+	// 審査員パネル（空の場合はサーバーの既定値）と判定の集計方法（"majority" or "average"）
+	JudgePanel       []JudgeSpec `json:"judge_panel,omitempty"`
+	JudgeAggregation string      `json:"judge_aggregation,omitempty"`
+
+	BiasCheck  *bool `json:"bias_check,omitempty"`  // 位置バイアスの確認（空の場合はサーバーの既定値）
+	FactCheck  *bool `json:"fact_check,omitempty"`  // 発言ごとのファクトチェック（空の場合はサーバーの既定値）
+	HintBudget *int  `json:"hint_budget,omitempty"` // コーチのヒントを使える回数（user_vs_llm のみ、空の場合はサーバーの既定値）
+
+	// 1回の発言とディベート全体の持ち時間（秒、0は制限なし、空の場合はサーバーの既定値）
+	TurnSeconds  *int `json:"turn_seconds,omitempty"`
+	TotalSeconds *int `json:"total_seconds,omitempty"`
+
+	// チーム戦の参加者（team のみ）。作成したユーザーはuser_positionの側の最初の人間の枠に入る
+	Participants []ParticipantSpec `json:"participants,omitempty"`
 }
 
 type CreateDebateResponse struct {
-	Session   DebateSession        `json:"session"`
-	TopicInfo *DebateTopicResponse `json:"topic_info,omitempty"`
+	Session    DebateSession        `json:"session"`
+	TopicInfo  *DebateTopicResponse `json:"topic_info,omitempty"`
+	InviteCode string               `json:"invite_code,omitempty"` // 作成したユーザーにだけ返す招待コード
+}
+
+type JoinDebateRequest struct {
+	InviteCode string `json:"invite_code"`
+	Side       string `json:"side,omitempty"` // team で参加する側（空の場合は空いている枠から）
 }
 
 type SendMessageRequest struct {
@@ -114,7 +398,30 @@ type SendMessageRequest struct {
 
 type SendMessageResponse struct {
 	UserMessage *DebateMessage `json:"user_message,omitempty"`
-	LLMMessage  DebateMessage  `json:"llm_message"`
+	LLMMessage  *DebateMessage `json:"llm_message,omitempty"` // フェーズのある形式で次がユーザーの番の場合は空
+	Phase       *PhaseStatus   `json:"phase,omitempty"`
+}
+
+// ストリーミング中の応答差分（SSEの"delta"イベント）
+type StreamDelta struct {
+	Role    string `json:"role"` // "llm", "llm1", "llm2"
+	Content string `json:"content"`
+}
+
+type HintRequest struct {
+	SessionID int64 `json:"session_id"`
+}
+
+// コーチが提案する反論の切り口
+type Hint struct {
+	Angle  string `json:"angle"`  // 切り口や相手の主張の弱点
+	Detail string `json:"detail"` // どう反論するかの説明
+}
+
+type HintResponse struct {
+	Hints          []Hint `json:"hints"`
+	HintsUsed      int    `json:"hints_used"`
+	HintsRemaining int    `json:"hints_remaining"`
 }
 
 type EndDebateRequest struct {
@@ -122,17 +429,75 @@ type EndDebateRequest struct {
 }
 
 type EndDebateResponse struct {
-	Session     DebateSession `json:"session"`
-	JudgeResult JudgeResponse `json:"judge_result"`
+	Session     DebateSession   `json:"session"`
+	JudgeResult JudgeResponse   `json:"judge_result"`       // 審査員パネルの判定を集計した結果
+	Ballots     []JudgeBallot   `json:"ballots,omitempty"`  // 審査員ごとの判定
+	Feedback    *FeedbackReport `json:"feedback,omitempty"` // ユーザーの発言へのフィードバック（user_vs_llm のみ）
+}
+
+// 終了後にユーザー自身の発言だけを振り返るフィードバック
+type FeedbackReport struct {
+	ID              int64            `json:"id"`
+	SessionID       int64            `json:"session_id"`
+	UserID          *int64           `json:"user_id,omitempty"`
+	Summary         string           `json:"summary"`
+	Turns           []TurnFeedback   `json:"turns"`
+	MissedRebuttals []MissedRebuttal `json:"missed_rebuttals"`
+	Fallacies       []Fallacy        `json:"fallacies"`
+	PracticeTopics  []string         `json:"practice_topics"`
+	Weaknesses      []string         `json:"weaknesses"` // 弱点の分類（"evidence", "rebuttal", "logic", "structure", "clarity", "relevance"）
+	PromptVersion   string           `json:"prompt_version,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
+
+// ユーザーの発言1つへの講評
+type TurnFeedback struct {
+	Turn      int    `json:"turn"`                 // ユーザーの何番目の発言か（1から）
+	MessageID int64  `json:"message_id,omitempty"` // 対応するメッセージ（特定できた場合のみ）
+	Strengths string `json:"strengths"`
+	Critique  string `json:"critique"`
+}
+
+// 反論しなかった相手の主張
+type MissedRebuttal struct {
+	Claim      string `json:"claim"`
+	Suggestion string `json:"suggestion"` // どう反論できたか
+}
+
+// ユーザーの発言に見られた論理的誤謬
+type Fallacy struct {
+	Name        string `json:"name"`
+	Quote       string `json:"quote"` // 該当する発言の抜粋
+	Explanation string `json:"explanation"`
+}
+
+// ユーザーの複数のディベートを通した弱点の傾向
+type FeedbackTrends struct {
+	Reports        int             `json:"reports"` // 集計したフィードバックの数
+	Weaknesses     []WeaknessTrend `json:"weaknesses"`
+	PracticeTopics []string        `json:"practice_topics"` // 最近のフィードバックで勧められた練習テーマ
+}
+
+type WeaknessTrend struct {
+	Category string    `json:"category"`
+	Count    int       `json:"count"` // 指摘されたディベートの数
+	Rate     float64   `json:"rate"`  // 指摘されたディベートの割合
+	LastSeen time.Time `json:"last_seen"`
 }
 
 type DebateHistoryResponse struct {
 	Session  DebateSession   `json:"session"`
 	Messages []DebateMessage `json:"messages"`
+	Usage    *SessionUsage   `json:"usage,omitempty"`
+	Verdict  *JudgeResult    `json:"verdict,omitempty"` // 終了したディベートの審査結果
+	Ballots  []JudgeResult   `json:"ballots,omitempty"` // 審査員ごとの判定
 }
 
 type LLMDebateStepResponse struct {
-	LLM1Message *DebateMessage `json:"llm1_message,omitempty"`
-	LLM2Message *DebateMessage `json:"llm2_message,omitempty"`
-	IsFinished  bool           `json:"is_finished"`
+	LLM1Message      *DebateMessage `json:"llm1_message,omitempty"`
+	LLM2Message      *DebateMessage `json:"llm2_message,omitempty"`
+	LLMMessage       *DebateMessage `json:"llm_message,omitempty"`       // user_vs_llm でLLMの番だった場合
+	ModeratorMessage *DebateMessage `json:"moderator_message,omitempty"` // 司会者が終了を判断した場合の理由
+	Phase            *PhaseStatus   `json:"phase,omitempty"`
+	IsFinished       bool           `json:"is_finished"`
 }
@@ -2,114 +2,330 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+)
+
+// llm.StreamProviderのインターフェースを満たすことを保証
+var _ llm.StreamProvider = (*Client)(nil)
+
+// 構造化出力の方式
+const (
+	StructuredJSONSchema = "json_schema" // response_formatでJSONスキーマを指定（OpenAI既定）
+	StructuredJSONObject = "json_object" // JSONモードを指定し、スキーマはプロンプトで指示
+	StructuredPrompt     = "prompt"      // プロンプトのみでスキーマを指示
+	StructuredAuto       = "auto"        // json_schemaから順に試し、非対応なら次の方式にフォールバック
 )
 
-type Message struct {
-	Role    string
-	Content string
+// フォールバックの順序
+var structuredFallbacks = []string{StructuredJSONSchema, StructuredJSONObject, StructuredPrompt}
+
+// クライアントの設定
+type Config struct {
+	APIKey  string
+	Model   string
+	BaseURL string            // OpenAI互換サーバーのURL（例: http://localhost:8000/v1、空の場合はOpenAI）
+	Headers map[string]string // リクエストに追加するヘッダー
+	NoAuth  bool              // Authorizationヘッダーを送らない
+	// 構造化出力の方式（空の場合はjson_schema）
+	StructuredOutput string
 }
 
 type Client struct {
-	client *openai.Client
-	model  string
+	client           *openai.Client
+	model            string
+	structuredOutput string
+
+	// autoモードで現在使っている方式（structuredFallbacksのインデックス）
+	mu              sync.Mutex
+	structuredLevel int
 }
 
-func NewClient(apiKey, model string) *Client {
-	apiKey = strings.TrimSpace(apiKey)
-	model = strings.TrimSpace(model)
+func NewClient(cfg Config) *Client {
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	model := strings.TrimSpace(cfg.Model)
 
-	client := openai.NewClient(
+	opts := []option.RequestOption{
 		option.WithAPIKey(apiKey),
-	)
+		// 再試行はllm.Resilientで行うため、SDK側の再試行は無効化する
+		option.WithMaxRetries(0),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(cfg.BaseURL))
+	}
+	for key, value := range cfg.Headers {
+		opts = append(opts, option.WithHeader(key, value))
+	}
+	if cfg.NoAuth {
+		opts = append(opts, option.WithHeaderDel("authorization"))
+	}
+
+	structuredOutput := cfg.StructuredOutput
+	if structuredOutput == "" {
+		structuredOutput = StructuredJSONSchema
+	}
+
+	client := openai.NewClient(opts...)
 
 	return &Client{
-		client: &client,
-		model:  model,
+		client:           &client,
+		model:            model,
+		structuredOutput: structuredOutput,
 	}
 }
 
 // 構造化出力を使用したチャット補完
-func (c *Client) ChatCompletionWithSchema(ctx context.Context, messages []Message, schemaName string, schema map[string]any) (string, error) {
+// 応答はスキーマに対して検証し、autoモードでは非対応の方式を順にフォールバックする
+// 失敗した場合も、それまでの試行で消費したトークン使用量をllm.ErrorのUsageで返す
+func (c *Client) ChatCompletionWithSchema(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema) (*llm.Response, error) {
+	if c.structuredOutput != StructuredAuto {
+		return c.completeStructured(ctx, messages, sampling, schema, c.structuredOutput)
+	}
+
+	c.mu.Lock()
+	level := c.structuredLevel
+	c.mu.Unlock()
+
+	usage := llm.Usage{Model: c.model}
+	for ; ; level++ {
+		mode := structuredFallbacks[level]
+		response, err := c.completeStructured(ctx, messages, sampling, schema, mode)
+		attempt := llm.UsageOf(err)
+		if response != nil {
+			attempt = response.Usage
+		}
+		usage.PromptTokens += attempt.PromptTokens
+		usage.CompletionTokens += attempt.CompletionTokens
+		if err == nil {
+			response.Usage = usage
+			return response, nil
+		}
+
+		// 方式が非対応の場合またはスキーマ不適合の場合のみ次の方式を試す
+		unsupported := unsupportedFormat(err)
+		if (!unsupported && !errors.Is(err, errSchemaMismatch)) || level == len(structuredFallbacks)-1 {
+			return nil, withUsage(err, usage)
+		}
+		log.Printf("[OpenAI] structured output %s failed, falling back to %s: %v", mode, structuredFallbacks[level+1], err)
+
+		// 非対応だった方式は以降の呼び出しでも飛ばす（スキーマ不適合はこの呼び出しのみ）
+		if unsupported {
+			c.mu.Lock()
+			c.structuredLevel = max(c.structuredLevel, level+1)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// 指定した方式で構造化出力を取得し、スキーマに対して検証
+// スキーマ不適合の場合も使用量を記録できるよう、エラーのUsageに使用量を入れて返す
+func (c *Client) completeStructured(ctx context.Context, messages []llm.Message, sampling llm.Sampling, schema llm.Schema, mode string) (*llm.Response, error) {
+	var format openai.ChatCompletionNewParamsResponseFormatUnion
+	switch mode {
+	case StructuredJSONSchema:
+		format.OfJSONSchema = &openai.ResponseFormatJSONSchemaParam{
+			Type: "json_schema",
+			JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   schema.Name,
+				Schema: schema.Schema,
+				Strict: openai.Bool(true),
+			},
+		}
+	case StructuredJSONObject, StructuredPrompt:
+		if mode == StructuredJSONObject {
+			format.OfJSONObject = &openai.ResponseFormatJSONObjectParam{}
+		}
+		instruction := schema.Instruction
+		if instruction == "" {
+			var err error
+			if instruction, err = defaultSchemaInstruction(schema); err != nil {
+				return nil, err
+			}
+		}
+		messages = append(append([]llm.Message{}, messages...), llm.Message{Role: "system", Content: instruction})
+	default:
+		return nil, fmt.Errorf("unknown structured output mode %q", mode)
+	}
+
+	response, err := c.complete(ctx, messages, sampling, format)
+	if err != nil {
+		return nil, err
+	}
+
+	content := llm.ExtractJSON(response.Content)
+	if err := llm.ValidateJSON(content, schema.Schema); err != nil {
+		log.Printf("[OpenAI] structured output (%s) does not match schema %s: %v", mode, schema.Name, err)
+		return nil, &llm.Error{Kind: llm.ErrorInvalid, Usage: response.Usage, Err: fmt.Errorf("%w %s: %v", errSchemaMismatch, schema.Name, err)}
+	}
+	response.Content = content
+	return response, nil
+}
+
+// 呼び出し側が指示を用意しなかった場合に、JSONスキーマに従った出力をプロンプトで指示するメッセージ
+// 言語に依存しないよう、説明文は付けずにスキーマだけを渡す
+func defaultSchemaInstruction(schema llm.Schema) (string, error) {
+	data, err := json.MarshalIndent(schema.Schema, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("JSON schema (%s):\n%s", schema.Name, data), nil
+}
+
+// 通常のチャット補完（構造化出力なし）
+func (c *Client) ChatCompletion(ctx context.Context, messages []llm.Message, sampling llm.Sampling) (*llm.Response, error) {
+	return c.complete(ctx, messages, sampling, openai.ChatCompletionNewParamsResponseFormatUnion{})
+}
+
+func (c *Client) complete(ctx context.Context, messages []llm.Message, sampling llm.Sampling, format openai.ChatCompletionNewParamsResponseFormatUnion) (*llm.Response, error) {
 	if c.model == "" {
 		err := errors.New("openai model is empty")
 		log.Printf("[OpenAI] %v", err)
-		return "", err
+		return nil, err
 	}
 	if len(messages) == 0 {
 		err := errors.New("openai messages are empty")
 		log.Printf("[OpenAI] %v", err)
-		return "", err
+		return nil, err
 	}
 
 	started := time.Now()
 	log.Printf("[OpenAI] ChatCompletion start model=%s messages=%d", c.model, len(messages))
 
-	chatMessages := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
-	for _, msg := range messages {
-		switch strings.ToLower(msg.Role) {
-		case "user":
-			chatMessages = append(chatMessages, openai.UserMessage(msg.Content))
-		case "assistant":
-			chatMessages = append(chatMessages, openai.AssistantMessage(msg.Content))
-		case "system":
-			chatMessages = append(chatMessages, openai.SystemMessage(msg.Content))
-		default:
-			chatMessages = append(chatMessages, openai.UserMessage(msg.Content))
-		}
-	}
+	chatMessages := toChatMessages(messages)
 
-	completion, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.ChatModel(c.model),
-		Messages: chatMessages,
-		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
-			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
-				Type: "json_schema",
-				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
-					Name:   schemaName,
-					Schema: schema,
-					Strict: openai.Bool(true),
-				},
-			},
-		},
-	})
+	completion, err := c.client.Chat.Completions.New(ctx, withSampling(sampling, openai.ChatCompletionNewParams{
+		Model:          openai.ChatModel(c.model),
+		Messages:       chatMessages,
+		ResponseFormat: format,
+	}))
 	if err != nil {
 		log.Printf("[OpenAI] request failed: %v", err)
-		return "", err
+		return nil, classifyError(err)
 	}
 
 	if len(completion.Choices) == 0 {
 		err := errors.New("openai response had no choices")
 		log.Printf("[OpenAI] %v", err)
-		return "", err
+		return nil, err
+	}
+	if completion.Choices[0].FinishReason == "content_filter" {
+		return nil, contentFilterError()
 	}
 
-	log.Printf("[OpenAI] ChatCompletion success duration=%s", time.Since(started))
-	return completion.Choices[0].Message.Content, nil
+	log.Printf("[OpenAI] ChatCompletion success duration=%s prompt_tokens=%d completion_tokens=%d",
+		time.Since(started), completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	return &llm.Response{
+		Content: completion.Choices[0].Message.Content,
+		Usage:   c.usage(completion.Usage),
+	}, nil
 }
 
-// 通常のチャット補完（構造化出力なし）
-func (c *Client) ChatCompletion(ctx context.Context, messages []Message) (string, error) {
+// ストリーミングでのチャット補完（差分ごとにonDeltaを呼び出す）
+func (c *Client) ChatCompletionStream(ctx context.Context, messages []llm.Message, sampling llm.Sampling, onDelta func(delta string) error) (*llm.Response, error) {
 	if c.model == "" {
 		err := errors.New("openai model is empty")
 		log.Printf("[OpenAI] %v", err)
-		return "", err
+		return nil, err
 	}
 	if len(messages) == 0 {
 		err := errors.New("openai messages are empty")
 		log.Printf("[OpenAI] %v", err)
-		return "", err
+		return nil, err
 	}
 
 	started := time.Now()
-	log.Printf("[OpenAI] ChatCompletion start model=%s messages=%d", c.model, len(messages))
+	log.Printf("[OpenAI] ChatCompletionStream start model=%s messages=%d", c.model, len(messages))
+
+	stream := c.client.Chat.Completions.NewStreaming(ctx, withSampling(sampling, openai.ChatCompletionNewParams{
+		Model:    openai.ChatModel(c.model),
+		Messages: toChatMessages(messages),
+		StreamOptions: openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		},
+	}))
+	defer stream.Close()
+
+	var content strings.Builder
+	var usage openai.CompletionUsage
+	for stream.Next() {
+		chunk := stream.Current()
+		// 最後のチャンクにのみ使用量が含まれる
+		if chunk.Usage.TotalTokens > 0 {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason == "content_filter" {
+			return nil, contentFilterError()
+		}
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			continue
+		}
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			log.Printf("[OpenAI] stream aborted: %v", err)
+			return nil, err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		log.Printf("[OpenAI] stream failed: %v", err)
+		return nil, classifyError(err)
+	}
 
+	if content.Len() == 0 {
+		err := errors.New("openai stream returned no content")
+		log.Printf("[OpenAI] %v", err)
+		return nil, err
+	}
+
+	log.Printf("[OpenAI] ChatCompletionStream success duration=%s prompt_tokens=%d completion_tokens=%d",
+		time.Since(started), usage.PromptTokens, usage.CompletionTokens)
+	return &llm.Response{
+		Content: content.String(),
+		Usage:   c.usage(usage),
+	}, nil
+}
+
+// サンプリングパラメータをリクエストに反映
+func withSampling(sampling llm.Sampling, params openai.ChatCompletionNewParams) openai.ChatCompletionNewParams {
+	if sampling.Temperature != nil {
+		params.Temperature = openai.Float(*sampling.Temperature)
+	}
+	if sampling.TopP != nil {
+		params.TopP = openai.Float(*sampling.TopP)
+	}
+	if sampling.MaxTokens != nil {
+		params.MaxCompletionTokens = openai.Int(*sampling.MaxTokens)
+	}
+	if sampling.Seed != nil {
+		params.Seed = openai.Int(*sampling.Seed)
+	}
+	return params
+}
+
+// OpenAIの使用量をllm.Usageに変換
+func (c *Client) usage(usage openai.CompletionUsage) llm.Usage {
+	return llm.Usage{
+		Model:            c.model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+}
+
+// llm.MessageをOpenAIのメッセージ形式に変換
+func toChatMessages(messages []llm.Message) []openai.ChatCompletionMessageParamUnion {
 	chatMessages := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
 	for _, msg := range messages {
 		switch strings.ToLower(msg.Role) {
@@ -123,22 +339,5 @@ func (c *Client) ChatCompletion(ctx context.Context, messages []Message) (string
 			chatMessages = append(chatMessages, openai.UserMessage(msg.Content))
 		}
 	}
-
-	completion, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.ChatModel(c.model),
-		Messages: chatMessages,
-	})
-	if err != nil {
-		log.Printf("[OpenAI] request failed: %v", err)
-		return "", err
-	}
-
-	if len(completion.Choices) == 0 {
-		err := errors.New("openai response had no choices")
-		log.Printf("[OpenAI] %v", err)
-		return "", err
-	}
-
-	log.Printf("[OpenAI] ChatCompletion success duration=%s", time.Since(started))
-	return completion.Choices[0].Message.Content, nil
+	return chatMessages
 }
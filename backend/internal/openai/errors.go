@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+
+	"github.com/levyxx/LLM-debate-battle/backend/internal/llm"
+)
+
+// 応答がスキーマに適合しなかったことを示す（その呼び出しだけ次の方式で再試行する）
+var errSchemaMismatch = errors.New("response does not match schema")
+
+// サーバーが構造化出力の方式（response_format）に対応していないことを示すエラーか
+// 文脈長の超過など、ほかの理由による4xxは方式を変えても解決しないためfalse
+func unsupportedFormat(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 {
+		return false
+	}
+	if strings.HasPrefix(apiErr.Param, "response_format") {
+		return true
+	}
+	message := strings.ToLower(apiErr.Error())
+	return strings.Contains(message, "response_format") || strings.Contains(message, "json_schema") || strings.Contains(message, "json_object")
+}
+
+// OpenAI SDKのエラーをllm.Errorに分類
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		classified := &llm.Error{
+			Kind:       llm.ErrorInvalid,
+			StatusCode: apiErr.StatusCode,
+			Err:        err,
+		}
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			classified.Kind = llm.ErrorRateLimit
+			classified.RetryAfter = retryAfter(apiErr.Response)
+		case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+			classified.Kind = llm.ErrorAuth
+		case apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusGatewayTimeout:
+			classified.Kind = llm.ErrorTimeout
+		case apiErr.StatusCode >= 500:
+			classified.Kind = llm.ErrorUnavailable
+			classified.RetryAfter = retryAfter(apiErr.Response)
+		case apiErr.Code == "content_filter" || apiErr.Code == "content_policy_violation":
+			classified.Kind = llm.ErrorContentFilter
+		}
+		return classified
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &llm.Error{Kind: llm.ErrorTimeout, Err: err}
+	}
+	if errors.As(err, &netErr) {
+		return &llm.Error{Kind: llm.ErrorUnavailable, Err: err}
+	}
+
+	return err
+}
+
+// 応答が途中でコンテンツフィルタにより打ち切られた場合のエラー
+func contentFilterError() error {
+	return &llm.Error{Kind: llm.ErrorContentFilter, Err: errors.New("response was blocked by the content filter")}
+}
+
+// Retry-After / retry-after-ms ヘッダーから待機時間を取得
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	if ms := resp.Header.Get("Retry-After-Ms"); ms != "" {
+		if value, err := strconv.ParseFloat(ms, 64); err == nil && value > 0 {
+			return time.Duration(value * float64(time.Millisecond))
+		}
+	}
+
+	header := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// 失敗した試行までに消費したトークン使用量をエラーに付ける（使用量がなければそのまま返す）
+func withUsage(err error, usage llm.Usage) error {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return err
+	}
+	var llmErr *llm.Error
+	if errors.As(err, &llmErr) {
+		withUsage := *llmErr
+		withUsage.Usage = usage
+		return &withUsage
+	}
+	return &llm.Error{Kind: llm.KindOf(err), Usage: usage, Err: err}
+}
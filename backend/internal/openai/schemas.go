@@ -114,6 +114,160 @@ var JudgeResultSchema = map[string]any{
 	"additionalProperties": false,
 }
 
+// ファクトチェック用のスキーマ
+var FactCheckSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"claims": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"claim": map[string]any{
+						"type":        "string",
+						"description": "発言に含まれる事実についての主張",
+					},
+					"rating": map[string]any{
+						"type":        "string",
+						"enum":        []string{"plausible", "dubious", "unverifiable"},
+						"description": "確からしさ（plausible=もっともらしい, dubious=疑わしい, unverifiable=確認できない）",
+					},
+					"note": map[string]any{
+						"type":        "string",
+						"description": "評価の理由",
+					},
+				},
+				"required":             []string{"claim", "rating", "note"},
+				"additionalProperties": false,
+			},
+			"description": "確認した主張",
+		},
+	},
+	"required":             []string{"claims"},
+	"additionalProperties": false,
+}
+
+// コーチのヒント用のスキーマ
+var CoachHintsSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"hints": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"angle": map[string]any{
+						"type":        "string",
+						"description": "反論の切り口や相手の主張の弱点",
+					},
+					"detail": map[string]any{
+						"type":        "string",
+						"description": "なぜ有効か、どの点を突けばよいかの説明",
+					},
+				},
+				"required":             []string{"angle", "detail"},
+				"additionalProperties": false,
+			},
+			"description": "2〜3個のヒント",
+		},
+	},
+	"required":             []string{"hints"},
+	"additionalProperties": false,
+}
+
+// 終了後のフィードバック用のスキーマ
+var FeedbackReportSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "ユーザーの議論全体への講評",
+		},
+		"turns": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"turn": map[string]any{
+						"type":        "integer",
+						"description": "ユーザーの何番目の発言か（1から）",
+					},
+					"strengths": map[string]any{
+						"type":        "string",
+						"description": "良かった点",
+					},
+					"critique": map[string]any{
+						"type":        "string",
+						"description": "改善点",
+					},
+				},
+				"required":             []string{"turn", "strengths", "critique"},
+				"additionalProperties": false,
+			},
+			"description": "ユーザーの発言ごとの講評",
+		},
+		"missed_rebuttals": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"claim": map[string]any{
+						"type":        "string",
+						"description": "ユーザーが反論しなかった相手の主張",
+					},
+					"suggestion": map[string]any{
+						"type":        "string",
+						"description": "どう反論できたか",
+					},
+				},
+				"required":             []string{"claim", "suggestion"},
+				"additionalProperties": false,
+			},
+			"description": "反論しなかった相手の主張",
+		},
+		"fallacies": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "誤謬の名前",
+					},
+					"quote": map[string]any{
+						"type":        "string",
+						"description": "該当する発言の抜粋",
+					},
+					"explanation": map[string]any{
+						"type":        "string",
+						"description": "なぜ誤謬か",
+					},
+				},
+				"required":             []string{"name", "quote", "explanation"},
+				"additionalProperties": false,
+			},
+			"description": "ユーザーの発言に見られた論理的誤謬",
+		},
+		"practice_topics": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "string",
+			},
+			"description": "弱点を練習するのに適したディベートのテーマ",
+		},
+		"weaknesses": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "string",
+				"enum": []string{"evidence", "rebuttal", "logic", "structure", "clarity", "relevance"},
+			},
+			"description": "ユーザーの弱点の分類",
+		},
+	},
+	"required":             []string{"summary", "turns", "missed_rebuttals", "fallacies", "practice_topics", "weaknesses"},
+	"additionalProperties": false,
+}
+
 // LLM同士のディベート継続判定用スキーマ
 var DebateContinueSchema = map[string]any{
 	"type": "object",
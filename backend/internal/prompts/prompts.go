@@ -0,0 +1,302 @@
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+const templateExt = ".tmpl"
+
+var versionPattern = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/\s*-?\}\}`)
+
+// 描画したプロンプト
+type Prompt struct {
+	System  string
+	User    string
+	Version string // "<言語>/<名前>@<バージョン>"
+}
+
+type templateSet struct {
+	templates map[string]*template.Template
+	versions  map[string]string
+}
+
+// プロンプトテンプレートの集合（ディレクトリ指定時はファイルの変更を再読み込みできる）
+// テンプレートは言語ごとのディレクトリに1ファイル1プロンプト（<言語>/<名前>.tmpl）で置き、
+// "system" / "user" ブロックを{{define}}で定義する
+// ファイル先頭の {{/* version: N */}} がバージョンとなり、生成結果とともに "<言語>/<名前>@<バージョン>" として保存される
+type Store struct {
+	dir string
+
+	mu          sync.RWMutex
+	set         *templateSet
+	fingerprint string
+}
+
+// 組み込みのテンプレートだけを使うStoreを作成
+func NewEmbedded() *Store {
+	s, err := NewStore("")
+	if err != nil {
+		// 組み込みのテンプレートはビルド時に含まれるため、ここで失敗するのはテンプレートの誤り
+		panic(err)
+	}
+	return s
+}
+
+// テンプレートを読み込んだStoreを作成
+// dirが空の場合は組み込みのテンプレートを使い、指定した場合はディレクトリにあるファイルで組み込みのものを上書きする
+func NewStore(dir string) (*Store, error) {
+	s := &Store{dir: dir}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// テンプレートを読み込み直す（失敗した場合は以前のテンプレートを使い続ける）
+func (s *Store) Reload() error {
+	files, err := s.readFiles()
+	if err != nil {
+		return err
+	}
+
+	set := &templateSet{
+		templates: make(map[string]*template.Template, len(files)),
+		versions:  make(map[string]string, len(files)),
+	}
+	for name, content := range files {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt %s: %w", name, err)
+		}
+		set.templates[name] = tmpl
+		set.versions[name] = name + "@" + templateVersion(content)
+	}
+
+	fingerprint, err := s.dirFingerprint()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.set = set
+	s.fingerprint = fingerprint
+	s.mu.Unlock()
+	return nil
+}
+
+// 組み込みのテンプレートと、ディレクトリにあるテンプレートを "<言語>/<名前>" ごとに読み込む
+func (s *Store) readFiles() (map[string]string, error) {
+	files := map[string]string{}
+	if err := readTemplates(embedded, "templates", files); err != nil {
+		return nil, err
+	}
+	if s.dir != "" {
+		if err := readTemplates(os.DirFS(s.dir), ".", files); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func readTemplates(fsys fs.FS, root string, files map[string]string) error {
+	matches, err := fs.Glob(fsys, path.Join(root, "*", "*"+templateExt))
+	if err != nil {
+		return fmt.Errorf("failed to read prompt directory: %w", err)
+	}
+	for _, file := range matches {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt %s: %w", file, err)
+		}
+		lang := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), templateExt)
+		files[lang+"/"+name] = string(data)
+	}
+	return nil
+}
+
+// ファイル先頭で宣言されたバージョン（宣言がなければ内容のハッシュ）
+func templateVersion(content string) string {
+	if m := versionPattern.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "sha-" + hex.EncodeToString(sum[:4])
+}
+
+// ディレクトリ内のテンプレートの名前・サイズ・更新日時から変更検知用の値を作る
+func (s *Store) dirFingerprint() (string, error) {
+	if s.dir == "" {
+		return "", nil
+	}
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*", "*"+templateExt))
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt directory: %w", err)
+	}
+
+	var parts []string
+	for _, file := range matches {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", file, info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ","), nil
+}
+
+// ディレクトリを定期的に確認し、変更があればテンプレートを読み込み直す（ctxが終了するまで）
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	if s.dir == "" || interval <= 0 {
+		return
+	}
+
+	s.mu.RLock()
+	lastSeen := s.fingerprint
+	s.mu.RUnlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fingerprint, err := s.dirFingerprint()
+			if err != nil {
+				log.Printf("Failed to check prompt templates: %v", err)
+				continue
+			}
+			// 読み込みに失敗した場合も、同じ内容を何度も読み直さないよう確認済みとする
+			if fingerprint == lastSeen {
+				continue
+			}
+			lastSeen = fingerprint
+			if err := s.Reload(); err != nil {
+				log.Printf("Failed to reload prompt templates (keeping previous version): %v", err)
+				continue
+			}
+			log.Printf("Reloaded prompt templates: %s", strings.Join(s.Versions(), ", "))
+		}
+	}
+}
+
+// 読み込み済みのプロンプトのバージョン一覧
+func (s *Store) Versions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := make([]string, 0, len(s.set.versions))
+	for _, v := range s.set.versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// テンプレートが用意されている言語の一覧
+func (s *Store) Languages() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var languages []string
+	for key := range s.set.templates {
+		lang, _, _ := strings.Cut(key, "/")
+		if !seen[lang] {
+			seen[lang] = true
+			languages = append(languages, lang)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// 指定した言語のプロンプトがあるか
+func (s *Store) Has(lang, name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.set.templates[lang+"/"+name]
+	return ok
+}
+
+// 指定した言語のプロンプトを描画（"user" ブロックが定義されていない場合、Userは空）
+func (s *Store) Render(lang, name string, data any) (*Prompt, error) {
+	key := lang + "/" + name
+	s.mu.RLock()
+	tmpl, ok := s.set.templates[key]
+	version := s.set.versions[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("prompt %q not found", key)
+	}
+
+	if tmpl.Lookup("system") == nil {
+		return nil, fmt.Errorf("prompt %q has no \"system\" block", key)
+	}
+	system, err := execute(tmpl, "system", data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	prompt := &Prompt{System: system, Version: version}
+
+	if tmpl.Lookup("user") != nil {
+		if prompt.User, err = execute(tmpl, "user", data); err != nil {
+			return nil, fmt.Errorf("failed to render prompt %s: %w", name, err)
+		}
+	}
+	return prompt, nil
+}
+
+// 指定した言語のプロンプトのブロックだけを描画
+func (s *Store) RenderBlock(lang, name, block string, data any) (string, error) {
+	key := lang + "/" + name
+	s.mu.RLock()
+	tmpl, ok := s.set.templates[key]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("prompt %q not found", key)
+	}
+	if tmpl.Lookup(block) == nil {
+		return "", fmt.Errorf("prompt %q has no %q block", key, block)
+	}
+	return execute(tmpl, block, data)
+}
+
+// 指定した言語のプロンプトにブロックが定義されているか
+func (s *Store) HasBlock(lang, name, block string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, ok := s.set.templates[lang+"/"+name]
+	return ok && tmpl.Lookup(block) != nil
+}
+
+func execute(tmpl *template.Template, block string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
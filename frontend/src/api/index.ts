@@ -13,6 +13,7 @@ import type {
   UserStats,
   DebateSession,
   DebateTopicInfo,
+  StreamDelta,
 } from '../types';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
@@ -33,19 +34,85 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// 認証エラー時にログイン画面へ戻す
+const handleUnauthorized = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('user');
+  window.location.href = '/login';
+};
+
 // レスポンスインターセプター：認証エラーの処理
 api.interceptors.response.use(
   (response) => response,
   (error) => {
     if (error.response?.status === 401) {
-      localStorage.removeItem('token');
-      localStorage.removeItem('user');
-      window.location.href = '/login';
+      handleUnauthorized();
     }
     return Promise.reject(error);
   }
 );
 
+// SSEのエンドポイントにPOSTし、deltaイベントをonDeltaへ渡して、doneイベントの内容を返す
+// EventSourceはPOSTできないため、fetchの応答をReadableStreamとして読む
+const postStream = async <T>(path: string, body: unknown, onDelta: (delta: StreamDelta) => void): Promise<T> => {
+  const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+  const token = localStorage.getItem('token');
+  if (token) {
+    headers.Authorization = `Bearer ${token}`;
+  }
+
+  const response = await fetch(`${API_BASE_URL}${path}`, {
+    method: 'POST',
+    headers,
+    body: JSON.stringify(body),
+  });
+  if (response.status === 401) {
+    handleUnauthorized();
+  }
+  if (!response.ok || !response.body) {
+    throw new Error((await response.text()) || `HTTP ${response.status}`);
+  }
+
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buffer += value;
+
+    // イベントは空行で区切られる
+    let boundary: number;
+    while ((boundary = buffer.indexOf('\n\n')) >= 0) {
+      const block = buffer.slice(0, boundary);
+      buffer = buffer.slice(boundary + 2);
+
+      let event = 'message';
+      const data: string[] = [];
+      for (const line of block.split('\n')) {
+        if (line.startsWith('event:')) {
+          event = line.slice(6).trim();
+        } else if (line.startsWith('data:')) {
+          data.push(line.slice(5).trimStart());
+        }
+      }
+      const payload = data.length > 0 ? JSON.parse(data.join('\n')) : null;
+
+      switch (event) {
+        case 'delta':
+          onDelta(payload as StreamDelta);
+          break;
+        case 'done':
+          await reader.cancel();
+          return payload as T;
+        case 'error':
+          await reader.cancel();
+          throw new Error(payload?.error || 'stream failed');
+      }
+    }
+  }
+  throw new Error('stream ended before the response was completed');
+};
+
 // 認証API
 export const authApi = {
   register: async (username: string, password: string): Promise<User> => {
@@ -85,6 +152,10 @@ export const debateApi = {
     return response.data;
   },
 
+  // LLMの応答を差分ごとに受け取りながらメッセージを送信
+  sendMessageStream: (data: SendMessageRequest, onDelta: (delta: StreamDelta) => void): Promise<SendMessageResponse> =>
+    postStream<SendMessageResponse>('/api/debate/message/stream', data, onDelta),
+
   endDebate: async (sessionId: number): Promise<EndDebateResponse> => {
     const response = await api.post<EndDebateResponse>('/api/debate/end', { session_id: sessionId });
     return response.data;
@@ -95,6 +166,10 @@ export const debateApi = {
     return response.data;
   },
 
+  // 応答を差分ごとに受け取りながらLLM同士のディベートを1ステップ進める
+  llmDebateStepStream: (sessionId: number, onDelta: (delta: StreamDelta) => void): Promise<LLMDebateStepResponse> =>
+    postStream<LLMDebateStepResponse>('/api/debate/llm-step/stream', { session_id: sessionId }, onDelta),
+
   getDebate: async (id: number): Promise<DebateHistoryResponse> => {
     const response = await api.get<DebateHistoryResponse>(`/api/debate/${id}`);
     return response.data;
@@ -1,7 +1,7 @@
 import React, { useState, useEffect, useRef } from 'react';
 import { useParams, useLocation, Link, useNavigate } from 'react-router-dom';
 import { debateApi } from '../api';
-import type { DebateSession, DebateMessage, JudgeResult } from '../types';
+import type { DebateSession, DebateMessage, JudgeResult, StreamDelta } from '../types';
 
 const DebateRoom: React.FC = () => {
   const { id } = useParams<{ id: string }>();
@@ -21,6 +21,8 @@ const DebateRoom: React.FC = () => {
   const [judgeResult, setJudgeResult] = useState<JudgeResult | null>(null);
   const [error, setError] = useState('');
   const [isLLMDebateRunning, setIsLLMDebateRunning] = useState(false);
+  const [pendingMessage, setPendingMessage] = useState(''); // 送信中のユーザーの発言
+  const [streaming, setStreaming] = useState<StreamDelta | null>(null); // 生成中のAIの発言
 
   // データの読み込み
   useEffect(() => {
@@ -33,13 +35,8 @@ const DebateRoom: React.FC = () => {
         setMessages(data.messages.filter(m => m.role !== 'system'));
         
         // 審査結果があれば取得
-        const judgeMessage = data.messages.find(m => m.role === 'judge');
-        if (judgeMessage) {
-          try {
-            setJudgeResult(JSON.parse(judgeMessage.content));
-          } catch {
-            // JSON解析に失敗した場合は無視
-          }
+        if (data.verdict) {
+          setJudgeResult(data.verdict);
         }
       } catch {
         setError('ディベートの読み込みに失敗しました');
@@ -53,35 +50,52 @@ const DebateRoom: React.FC = () => {
     }
   }, [id, session]);
 
-  // メッセージが追加されたらスクロール
+  // メッセージが追加されたら（生成中の発言が伸びたときも）スクロール
   useEffect(() => {
     messagesEndRef.current?.scrollIntoView({ behavior: 'smooth' });
-  }, [messages]);
+  }, [messages, pendingMessage, streaming]);
+
+  // 生成中の発言に差分を追加（発言者が変わったら新しい発言として表示）
+  const appendDelta = (delta: StreamDelta) => {
+    setStreaming(prev =>
+      prev && prev.role === delta.role
+        ? { role: prev.role, content: prev.content + delta.content }
+        : delta
+    );
+  };
 
   // メッセージ送信
   const handleSendMessage = async () => {
     if (!inputMessage.trim() || !session || isSending) return;
 
+    const content = inputMessage;
     setIsSending(true);
     setError('');
+    setPendingMessage(content);
+    setInputMessage('');
 
     try {
-      const response = await debateApi.sendMessage({
+      const response = await debateApi.sendMessageStream({
         session_id: session.id,
-        content: inputMessage,
-      });
+        content,
+      }, appendDelta);
 
+      // 生成中の表示を保存された発言に置き換える
       const newMessages: DebateMessage[] = [];
       if (response.user_message) {
         newMessages.push(response.user_message);
       }
-      newMessages.push(response.llm_message);
+      if (response.llm_message) {
+        newMessages.push(response.llm_message);
+      }
 
       setMessages(prev => [...prev, ...newMessages]);
-      setInputMessage('');
     } catch {
       setError('メッセージの送信に失敗しました');
+      setInputMessage(content);
     } finally {
+      setPendingMessage('');
+      setStreaming(null);
       setIsSending(false);
     }
   };
@@ -97,17 +111,17 @@ const DebateRoom: React.FC = () => {
       // 10ステップ分（5往復）を自動実行、各ステップで1つのLLMが応答
       let finished = false;
       for (let i = 0; i < 10 && !finished && !isEndingRef.current; i++) {
-        const response = await debateApi.llmDebateStep(session.id);
-        
+        const response = await debateApi.llmDebateStepStream(session.id, appendDelta);
+        setStreaming(null);
+
         // 審査中なら即座にループを抜ける
         if (isEndingRef.current) break;
 
-        // 応答が返ってきた瞬間に表示（1つずつ）
-        if (response.llm1_message) {
-          setMessages(prev => [...prev, response.llm1_message!]);
-        }
-        if (response.llm2_message) {
-          setMessages(prev => [...prev, response.llm2_message!]);
+        // 生成中の表示を保存された発言に置き換える（1つずつ）
+        const stepMessages = [response.llm_message, response.llm1_message, response.llm2_message]
+          .filter((m): m is DebateMessage => m !== undefined);
+        if (stepMessages.length > 0) {
+          setMessages(prev => [...prev, ...stepMessages]);
         }
 
         finished = response.is_finished;
@@ -127,6 +141,7 @@ const DebateRoom: React.FC = () => {
         setError('ディベートの進行に失敗しました');
       }
     } finally {
+      setStreaming(null);
       setIsLLMDebateRunning(false);
     }
   };
@@ -224,7 +239,7 @@ const DebateRoom: React.FC = () => {
 
       {/* メッセージエリア */}
       <div className="messages-container">
-        {messages.length === 0 ? (
+        {messages.length === 0 && !pendingMessage && !streaming ? (
           <div className="empty-messages">
             <p>
               {session.mode === 'user_vs_llm'
@@ -233,17 +248,35 @@ const DebateRoom: React.FC = () => {
             </p>
           </div>
         ) : (
-          messages.map((msg) => (
-            <div key={msg.id} className={`message ${getMessageStyle(msg.role)}`}>
-              <div className="message-header">
-                <span className="message-role">{getRoleLabel(msg.role)}</span>
-                <span className="message-time">
-                  {new Date(msg.created_at).toLocaleTimeString('ja-JP')}
-                </span>
+          <>
+            {messages.map((msg) => (
+              <div key={msg.id} className={`message ${getMessageStyle(msg.role)}`}>
+                <div className="message-header">
+                  <span className="message-role">{getRoleLabel(msg.role)}</span>
+                  <span className="message-time">
+                    {new Date(msg.created_at).toLocaleTimeString('ja-JP')}
+                  </span>
+                </div>
+                <div className="message-content">{msg.content}</div>
               </div>
-              <div className="message-content">{msg.content}</div>
-            </div>
-          ))
+            ))}
+            {pendingMessage && (
+              <div className={`message ${getMessageStyle('user')}`}>
+                <div className="message-header">
+                  <span className="message-role">{getRoleLabel('user')}</span>
+                </div>
+                <div className="message-content">{pendingMessage}</div>
+              </div>
+            )}
+            {streaming && (
+              <div className={`message ${getMessageStyle(streaming.role)} message-streaming`}>
+                <div className="message-header">
+                  <span className="message-role">{getRoleLabel(streaming.role)}</span>
+                </div>
+                <div className="message-content">{streaming.content}</div>
+              </div>
+            )}
+          </>
         )}
         <div ref={messagesEndRef} />
       </div>
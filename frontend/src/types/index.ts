@@ -95,7 +95,7 @@ export interface SendMessageRequest {
 
 export interface SendMessageResponse {
   user_message?: DebateMessage;
-  llm_message: DebateMessage;
+  llm_message?: DebateMessage;
 }
 
 export interface EndDebateResponse {
@@ -104,6 +104,7 @@ export interface EndDebateResponse {
 }
 
 export interface LLMDebateStepResponse {
+  llm_message?: DebateMessage;
   llm1_message?: DebateMessage;
   llm2_message?: DebateMessage;
   is_finished: boolean;
@@ -112,4 +113,11 @@ export interface LLMDebateStepResponse {
 export interface DebateHistoryResponse {
   session: DebateSession;
   messages: DebateMessage[];
+  verdict?: JudgeResult;
+}
+
+// ストリーミング中の応答の差分
+export interface StreamDelta {
+  role: string;
+  content: string;
 }